@@ -16,34 +16,50 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/provisioner"
 	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/azure"
 	"sigs.k8s.io/cosi-driver-sample/pkg/clients/fake"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/gcs"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/local"
 	"sigs.k8s.io/cosi-driver-sample/pkg/clients/s3"
 	"sigs.k8s.io/cosi-driver-sample/pkg/config"
 	"sigs.k8s.io/cosi-driver-sample/pkg/driver"
-	yaml "sigs.k8s.io/yaml/goyaml.v3"
 )
 
 type runOptions struct {
 	driverName   string
 	cosiEndpoint string
 	configPath   string
-
-	s3endpoint string
-	s3region   string
-	s3ssl      bool
-	s3admin    s3.S3Credentials
-	s3user     s3.S3Credentials
+	configReload time.Duration
+
+	azureAccount  string
+	azureKey      string
+	azureEndpoint string
+
+	gcsEndpoint  string
+	gcsProjectID string
+	gcsKey       string
+
+	s3endpoint    string
+	s3iamEndpoint string
+	s3region      string
+	s3ssl         bool
+	s3quotas      bool
+	s3admin       s3.S3Credentials
 }
 
 func defaultEnv(key, defaultValue string) string {
@@ -60,25 +76,38 @@ func asBool(v string) bool {
 	return b
 }
 
+func asDuration(v string) time.Duration {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		klog.ErrorS(err, "Invalid duration, using 0", "value", v)
+	}
+	return d
+}
+
 func main() {
 	klog.InitFlags(nil)
 	flag.Parse()
 
 	opts := runOptions{
-		cosiEndpoint: defaultEnv("COSI_ENDPOINT", "unix:///var/lib/cosi/cosi.sock"),
-		driverName:   defaultEnv("X_COSI_DRIVER_NAME", "sample.objectstorage.k8s.io"),
-		configPath:   defaultEnv("X_COSI_CONFIG", "/etc/cosi/config.yaml"),
-		s3endpoint:   defaultEnv("S3_ENDPOINT", ""),
-		s3region:     defaultEnv("S3_REGION", ""),
-		s3ssl:        asBool(defaultEnv("S3_SSL", "true")),
+		cosiEndpoint:  defaultEnv("COSI_ENDPOINT", "unix:///var/lib/cosi/cosi.sock"),
+		driverName:    defaultEnv("X_COSI_DRIVER_NAME", "sample.objectstorage.k8s.io"),
+		configPath:    defaultEnv("X_COSI_CONFIG", "/etc/cosi/config.yaml"),
+		configReload:  asDuration(defaultEnv("X_COSI_CONFIG_RELOAD_INTERVAL", "5s")),
+		azureAccount:  defaultEnv("AZURE_STORAGE_ACCOUNT", ""),
+		azureKey:      defaultEnv("AZURE_STORAGE_KEY", ""),
+		azureEndpoint: defaultEnv("AZURE_BLOB_ENDPOINT", ""),
+		gcsEndpoint:   defaultEnv("GCS_ENDPOINT", ""),
+		gcsProjectID:  defaultEnv("GCS_PROJECT_ID", ""),
+		gcsKey:        defaultEnv("GCS_SERVICE_ACCOUNT_KEY", ""),
+		s3endpoint:    defaultEnv("S3_ENDPOINT", ""),
+		s3iamEndpoint: defaultEnv("S3_IAM_ENDPOINT", ""),
+		s3region:      defaultEnv("S3_REGION", ""),
+		s3ssl:         asBool(defaultEnv("S3_SSL", "true")),
+		s3quotas:      asBool(defaultEnv("S3_QUOTAS", "false")),
 		s3admin: s3.S3Credentials{
 			AccessKeyID:     defaultEnv("S3_ADMIN_ACCESS_KEY_ID", ""),
 			AccessSecretKey: defaultEnv("S3_ADMIN_ACCESS_SECRET_KEY", ""),
 		},
-		s3user: s3.S3Credentials{
-			AccessKeyID:     defaultEnv("S3_USER_ACCESS_KEY_ID", ""),
-			AccessSecretKey: defaultEnv("S3_USER_ACCESS_SECRET_KEY", ""),
-		},
 	}
 
 	if err := run(context.Background(), opts); err != nil {
@@ -95,45 +124,76 @@ func run(ctx context.Context, opts runOptions) error {
 	)
 	defer stop()
 
-	cfg := config.Config{}
-
-	f, err := os.Open(opts.configPath)
+	cfg, err := config.Load(opts.configPath)
 	if err != nil {
-		return fmt.Errorf("unable to open config: %w", err)
+		return err
 	}
-	defer f.Close() //nolint:errcheck // best effort call
+	store := config.NewStore(cfg)
 
-	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
-		return fmt.Errorf("unable to read config: %w", err)
+	if opts.configReload > 0 {
+		watcher, err := config.NewWatcher(opts.configPath, store, opts.configReload)
+		if err != nil {
+			return err
+		}
+		go watcher.Run(ctx)
 	}
 
 	var c clients.Client
 	switch cfg.Mode {
 	case config.ModeAzure:
-		// TODO: implement real minimal Azure connector?
-		panic("unimplemented")
+		c, err = azure.New(opts.azureAccount, opts.azureKey, opts.azureEndpoint)
+		if err != nil {
+			return fmt.Errorf("unable to create azure client: %w", err)
+		}
+
+	case config.ModeGCS:
+		c, err = gcs.New(opts.gcsEndpoint, opts.gcsProjectID, []byte(opts.gcsKey))
+		if err != nil {
+			return fmt.Errorf("unable to create gcs client: %w", err)
+		}
 
 	case config.ModeS3:
 		c, err = s3.New(
 			opts.s3endpoint, opts.s3region,
-			opts.s3admin, opts.s3user,
-			opts.s3ssl,
+			opts.s3admin, opts.s3iamEndpoint,
+			opts.s3ssl, opts.s3quotas,
 		)
 		if err != nil {
 			return fmt.Errorf("unable to create s3 client: %w", err)
 		}
 
 	case config.ModeAzureFake:
-		c = fake.New("azure")
+		c, err = newFake(ctx, "azure", cfg.Fake)
+		if err != nil {
+			return fmt.Errorf("unable to create fake client: %w", err)
+		}
+
+	case config.ModeGCSFake:
+		c, err = newFake(ctx, "gcs", cfg.Fake)
+		if err != nil {
+			return fmt.Errorf("unable to create fake client: %w", err)
+		}
 
 	case config.ModeS3Fake:
-		c = fake.New("s3")
+		c, err = newFake(ctx, "s3", cfg.Fake)
+		if err != nil {
+			return fmt.Errorf("unable to create fake client: %w", err)
+		}
+
+	case config.ModeS3Local:
+		c, err = local.New(cfg.Local.Root)
+		if err != nil {
+			return fmt.Errorf("unable to create local client: %w", err)
+		}
 	}
 
-	identityServer := &driver.IdentityServer{Name: opts.driverName}
+	identityServer := &driver.IdentityServer{
+		Name:   opts.driverName,
+		Config: store,
+	}
 	provisionerServer := &driver.ProvisionerServer{
 		Client: c,
-		Config: cfg,
+		Config: store,
 	}
 
 	server, err := provisioner.NewDefaultCOSIProvisionerServer(
@@ -147,3 +207,49 @@ func run(ctx context.Context, opts runOptions) error {
 
 	return server.Run(ctx)
 }
+
+// newFake opens the fake client and, if configured, starts its embedded storage server until ctx is done.
+func newFake(ctx context.Context, platform string, cfg config.Fake) (*fake.Client, error) {
+	c, err := fake.Open(platform, cfg.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Server.Address == "" {
+		return c, nil
+	}
+
+	endpoint := cfg.Server.Endpoint
+	if endpoint == "" {
+		endpoint = "http://" + cfg.Server.Address
+	}
+
+	handler, err := c.Handler(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", cfg.Server.Address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for the embedded server: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck // best effort call
+	}()
+
+	go func() {
+		klog.InfoS("Serving embedded storage server", "address", listener.Addr(), "endpoint", endpoint)
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.ErrorS(err, "Embedded storage server failed")
+		}
+	}()
+
+	return c, nil
+}
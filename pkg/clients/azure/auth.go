@@ -0,0 +1,211 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// APIVersion is the Blob service REST API version used by the client.
+	APIVersion = "2021-08-06"
+
+	// SASVersion is the signed version of the SAS tokens issued by the client.
+	SASVersion = "2020-12-06"
+)
+
+// ContainerSAS describes a service SAS scoped to a single container.
+// When Identifier is set, permissions and validity are taken from the stored access policy
+// with the same name, which allows the token to be revoked by deleting the policy.
+type ContainerSAS struct {
+	Account     string    // Name of the storage account.
+	Container   string    // Name of the container the token is scoped to.
+	Identifier  string    // Name of the stored access policy (si).
+	Permissions string    // Signed permissions (sp), e.g. "racwdl".
+	Start       time.Time // Signed start (st), optional.
+	Expiry      time.Time // Signed expiry (se), optional when Identifier is set.
+	Version     string    // Signed version (sv), defaults to SASVersion.
+}
+
+// Sign returns the SAS query parameters including the signature computed with the account key.
+func (s ContainerSAS) Sign(key []byte) url.Values {
+	if s.Version == "" {
+		s.Version = SASVersion
+	}
+
+	values := url.Values{}
+	values.Set("sv", s.Version)
+	values.Set("sr", "c")
+	setIf(values, "si", s.Identifier)
+	setIf(values, "sp", s.Permissions)
+	setIf(values, "st", formatTime(s.Start))
+	setIf(values, "se", formatTime(s.Expiry))
+	values.Set("sig", s.Signature(key))
+
+	return values
+}
+
+// Signature computes the signature of the SAS using the account key.
+func (s ContainerSAS) Signature(key []byte) string {
+	if s.Version == "" {
+		s.Version = SASVersion
+	}
+
+	stringToSign := strings.Join([]string{
+		s.Permissions,
+		formatTime(s.Start),
+		formatTime(s.Expiry),
+		"/blob/" + s.Account + "/" + s.Container,
+		s.Identifier,
+		"", // signedIP
+		"", // signedProtocol
+		s.Version,
+		"c",
+		"", // signedSnapshotTime
+		"", // signedEncryptionScope
+		"", // rscc
+		"", // rscd
+		"", // rsce
+		"", // rscl
+		"", // rsct
+	}, "\n")
+
+	return sign(key, stringToSign)
+}
+
+// ParseContainerSAS reads a container SAS from query parameters.
+func ParseContainerSAS(account, container string, q url.Values) (ContainerSAS, error) {
+	sas := ContainerSAS{
+		Account:     account,
+		Container:   container,
+		Identifier:  q.Get("si"),
+		Permissions: q.Get("sp"),
+		Version:     q.Get("sv"),
+	}
+
+	var err error
+	if st := q.Get("st"); st != "" {
+		if sas.Start, err = time.Parse(time.RFC3339, st); err != nil {
+			return ContainerSAS{}, err
+		}
+	}
+	if se := q.Get("se"); se != "" {
+		if sas.Expiry, err = time.Parse(time.RFC3339, se); err != nil {
+			return ContainerSAS{}, err
+		}
+	}
+
+	return sas, nil
+}
+
+// SignRequest adds the SharedKey Authorization header to the request.
+func SignRequest(req *http.Request, account string, key []byte, now time.Time) {
+	req.Header.Set("X-Ms-Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", APIVersion)
+	req.Header.Set("Authorization", "SharedKey "+account+":"+SharedKeySignature(req, account, key))
+}
+
+// SharedKeySignature computes the SharedKey signature of the request.
+func SharedKeySignature(req *http.Request, account string, key []byte) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedHeaders(req.Header) + canonicalizedResource(req.URL, account),
+	}, "\n")
+
+	return sign(key, stringToSign)
+}
+
+func canonicalizedHeaders(h http.Header) string {
+	names := []string{}
+	for k := range h {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(h.Get(name)) + "\n")
+	}
+
+	return b.String()
+}
+
+func canonicalizedResource(u *url.URL, account string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	resource := "/" + account + path
+
+	q := u.Query()
+	names := make([]string, 0, len(q))
+	for k := range q {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := append([]string(nil), q[name]...)
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	return resource
+}
+
+func sign(key []byte, stringToSign string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func setIf(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azure provides an Azure Blob Storage client implementation.
+// It talks to the Blob service REST API directly using SharedKey authorization,
+// which makes it usable against both Azure Storage accounts and the Azurite emulator.
+// Containers are used as buckets, and bucket access is granted with container-scoped SAS tokens
+// bound to stored access policies, so that revoking access invalidates the issued token.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+const (
+	publicAccessKey = "publicAccess"
+
+	// publicAccessNone is the default public access level of a container.
+	publicAccessNone = "none"
+
+	// sasPermissions are the permissions granted to bucket accesses: read, add, create, write, delete and list.
+	sasPermissions = "racwdl"
+
+	// sasValidity is the validity of the stored access policy backing an issued SAS token.
+	sasValidity = 365 * 24 * time.Hour
+
+	// maxIdentifierLength is the maximum length of a stored access policy identifier.
+	maxIdentifierLength = 64
+
+	// identifierHashLength is the length of the hash ending the identifiers of users with longer names.
+	identifierHashLength = 16
+
+	// maxAccessPolicies is the maximum number of stored access policies of a container.
+	maxAccessPolicies = 5
+
+	// metadataHeader is the prefix of the headers holding the metadata of a container.
+	metadataHeader = "X-Ms-Meta-"
+
+	// maxMetadataSize is the maximum total size of the names and values of the metadata of a container.
+	maxMetadataSize = 8 << 10
+)
+
+// metadataNamePattern matches valid metadata names, which must be C# identifiers.
+var metadataNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// schema is the set of BucketClass parameters understood by CreateBucket.
+var schema = clients.Schema{
+	{
+		Name:    publicAccessKey,
+		Type:    clients.String,
+		Allowed: []string{publicAccessNone, "blob", "container"},
+		Default: publicAccessNone,
+		Mutable: true,
+	},
+	{Name: clients.TagsKey, Type: clients.String, Mutable: true},
+}
+
+// Client represents an Azure Blob Storage client instance.
+type Client struct {
+	account  string       // Name of the storage account.
+	key      []byte       // Decoded storage account key.
+	endpoint string       // Blob service endpoint, including the account path for the emulator.
+	http     *http.Client // HTTP client used to send requests.
+	now      func() time.Time
+}
+
+// Verify that Client implements the clients.Client interface.
+var _ clients.Client = (*Client)(nil)
+
+// StorageError is an error response returned by the Blob service.
+type StorageError struct {
+	StatusCode int    `xml:"-"`       // HTTP status code of the response.
+	Code       string `xml:"Code"`    // Error code, e.g. ContainerNotFound.
+	Message    string `xml:"Message"` // Human-readable description of the error.
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("azure: %s (status %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Unwrap returns the error of the clients package matching the code and status of the error, if any.
+func (e *StorageError) Unwrap() error {
+	switch {
+	case e.Code == "ContainerAlreadyExists":
+		return clients.ErrBucketAlreadyExists
+	case e.StatusCode == http.StatusNotFound:
+		return clients.ErrBucketNotFound
+	case e.StatusCode == http.StatusForbidden:
+		return clients.ErrPermissionDenied
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusServiceUnavailable:
+		return clients.ErrThrottled
+	default:
+		return nil
+	}
+}
+
+// user implements the clients.User interface and represents a holder of a container SAS token.
+type user struct {
+	name   string
+	token  string
+	expiry time.Time
+}
+
+// Verify that user implements the clients.User interface.
+var _ clients.User = (*user)(nil)
+
+// Name returns the name of the user.
+func (u *user) Name() string {
+	return u.name
+}
+
+// Credentials returns a map of the user's SAS token and its expiry.
+func (u *user) Credentials() map[string]string {
+	return map[string]string{
+		"accessToken":     u.token,
+		"expiryTimeStamp": u.expiry.UTC().Format(time.RFC3339),
+	}
+}
+
+// Platform returns the name of the platform associated with the user.
+func (u *user) Platform() string {
+	return "azure"
+}
+
+// New creates a new Azure Blob Storage Client instance.
+// The key is the base64 encoded storage account key. When endpoint is empty,
+// the public Azure endpoint of the account is used.
+func New(account, key, endpoint string) (*Client, error) {
+	if account == "" {
+		return nil, errors.New("storage account name is required")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode storage account key: %w", err)
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid blob endpoint: %w", err)
+	}
+
+	return &Client{
+		account:  account,
+		key:      decoded,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     http.DefaultClient,
+		now:      time.Now,
+	}, nil
+}
+
+// do sends a signed request to the container resource and returns the response body.
+func (c *Client) do(
+	ctx context.Context,
+	method, container string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, []byte, error) {
+	u := c.endpoint + "/" + url.PathEscape(container) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	SignRequest(req, c.account, c.key, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // best effort call
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		storageErr := &StorageError{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(data, storageErr) //nolint:errcheck // HEAD and some errors have no body
+		if storageErr.Code == "" {
+			storageErr.Code = resp.Header.Get("X-Ms-Error-Code")
+		}
+		return resp, data, storageErr
+	}
+
+	return resp, data, nil
+}
+
+func containerQuery(comp string) url.Values {
+	q := url.Values{"restype": {"container"}}
+	if comp != "" {
+		q.Set("comp", comp)
+	}
+	return q
+}
+
+func isNotFound(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.StatusCode == http.StatusNotFound
+}
+
+// BucketExists checks if a container exists in the storage account.
+func (c *Client) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	_, _, err := c.do(ctx, http.MethodGet, bucket, containerQuery(""), nil, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsBucketEqual checks if the existing container has the expected public access level and metadata.
+// Metadata missing from the tags parameter, such as the static tags of the driver, is ignored.
+// Unknown parameters are treated as a mismatch.
+func (c *Client) IsBucketEqual(ctx context.Context, bucket string, params map[string]string) (bool, error) {
+	expected := publicAccessNone
+	expectedMetadata := map[string]string{}
+	for k, v := range params {
+		switch k {
+		case publicAccessKey:
+			if v != "" {
+				expected = v
+			}
+		case clients.TagsKey:
+			tags, err := clients.ParseTags(v)
+			if err != nil {
+				return false, nil
+			}
+			for name, value := range tags {
+				expectedMetadata[strings.ToLower(name)] = value
+			}
+		default:
+			return false, nil
+		}
+	}
+
+	resp, _, err := c.do(ctx, http.MethodGet, bucket, containerQuery(""), nil, nil)
+	if err != nil {
+		return false, err
+	}
+
+	actual := resp.Header.Get("X-Ms-Blob-Public-Access")
+	if actual == "" {
+		actual = publicAccessNone
+	}
+
+	return actual == expected && clients.HasTags(metadata(resp.Header), expectedMetadata), nil
+}
+
+// metadata returns the metadata of a container from the headers of a response, with lowercased names.
+func metadata(header http.Header) map[string]string {
+	m := map[string]string{}
+	for k := range header {
+		if name, ok := strings.CutPrefix(k, metadataHeader); ok {
+			m[strings.ToLower(name)] = header.Get(k)
+		}
+	}
+	return m
+}
+
+// validateMetadata checks that the tags are valid container metadata: names must be C# identifiers,
+// unique regardless of case, values must be printable ASCII, and the whole metadata must fit in 8 KiB.
+func validateMetadata(tags map[string]string) error {
+	size := 0
+	seen := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(tags)) {
+		value := tags[name]
+		if !metadataNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid tag %q: metadata names must be C# identifiers", name)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("duplicate tag %q: metadata names are case-insensitive", name)
+		}
+		seen[strings.ToLower(name)] = true
+		if strings.IndexFunc(value, func(r rune) bool { return r < ' ' || r > '~' }) >= 0 {
+			return fmt.Errorf("invalid value of tag %q: metadata values must be printable ASCII", name)
+		}
+		size += len(name) + len(value)
+	}
+
+	if size > maxMetadataSize {
+		return fmt.Errorf("tags exceed the %d bytes of container metadata", maxMetadataSize)
+	}
+	return nil
+}
+
+// CreateBucket creates a new container in the storage account.
+// The optional publicAccess parameter accepts "none", "blob" or "container".
+// The optional tags parameter is applied as the metadata of the container.
+// It fails with clients.ErrInvalidParameters if the parameters are not supported,
+// and with clients.ErrBucketAlreadyExists if the container already exists.
+func (c *Client) CreateBucket(ctx context.Context, bucket string, params map[string]string) error {
+	header := http.Header{}
+	for k, v := range params {
+		switch k {
+		case publicAccessKey:
+			switch v {
+			case publicAccessNone, "":
+			case "blob", "container":
+				header.Set("X-Ms-Blob-Public-Access", v)
+			default:
+				return fmt.Errorf("%w: invalid %s value: %q", clients.ErrInvalidParameters, publicAccessKey, v)
+			}
+		case clients.TagsKey:
+			tags, err := clients.ParseTags(v)
+			if err == nil {
+				err = validateMetadata(tags)
+			}
+			if err != nil {
+				return fmt.Errorf("%w: invalid %s value: %w", clients.ErrInvalidParameters, clients.TagsKey, err)
+			}
+			for name, value := range tags {
+				header.Set(metadataHeader+name, value)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported parameter: %q", clients.ErrInvalidParameters, k)
+		}
+	}
+
+	_, _, err := c.do(ctx, http.MethodPut, bucket, containerQuery(""), header, nil)
+	return err
+}
+
+// DeleteBucket deletes a container from the storage account, along with its blobs.
+// It fails with clients.ErrBucketNotFound if the container does not exist.
+func (c *Client) DeleteBucket(ctx context.Context, bucket string) error {
+	_, _, err := c.do(ctx, http.MethodDelete, bucket, containerQuery(""), nil, nil)
+	return err
+}
+
+// signedIdentifiers is the container ACL document.
+type signedIdentifiers struct {
+	XMLName     xml.Name           `xml:"SignedIdentifiers"`
+	Identifiers []signedIdentifier `xml:"SignedIdentifier"`
+}
+
+type signedIdentifier struct {
+	ID           string       `xml:"Id"`
+	AccessPolicy accessPolicy `xml:"AccessPolicy"`
+}
+
+type accessPolicy struct {
+	Start      string `xml:"Start,omitempty"`
+	Expiry     string `xml:"Expiry,omitempty"`
+	Permission string `xml:"Permission,omitempty"`
+}
+
+// getACL returns the stored access policies of the container and its public access level.
+func (c *Client) getACL(ctx context.Context, bucket string) (*signedIdentifiers, string, error) {
+	resp, data, err := c.do(ctx, http.MethodGet, bucket, containerQuery("acl"), nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	acl := &signedIdentifiers{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := xml.Unmarshal(data, acl); err != nil {
+			return nil, "", fmt.Errorf("unable to decode container ACL: %w", err)
+		}
+	}
+
+	return acl, resp.Header.Get("X-Ms-Blob-Public-Access"), nil
+}
+
+// setACL replaces the stored access policies of the container, preserving its public access level.
+func (c *Client) setACL(ctx context.Context, bucket string, acl *signedIdentifiers, publicAccess string) error {
+	body, err := xml.Marshal(acl)
+	if err != nil {
+		return fmt.Errorf("unable to encode container ACL: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	if publicAccess != "" {
+		header.Set("X-Ms-Blob-Public-Access", publicAccess)
+	}
+
+	_, _, err = c.do(ctx, http.MethodPut, bucket, containerQuery("acl"), header, append([]byte(xml.Header), body...))
+	return err
+}
+
+// identifier returns the stored access policy name used for the user.
+// Names longer than an identifier are shortened and end with a hash of the full name, so they remain distinct.
+func identifier(userID string) string {
+	if len(userID) <= maxIdentifierLength {
+		return userID
+	}
+	sum := sha256.Sum256([]byte(userID))
+	return userID[:maxIdentifierLength-identifierHashLength-1] + "-" + hex.EncodeToString(sum[:])[:identifierHashLength]
+}
+
+// CreateBucketAccess creates a stored access policy for the user on the container
+// and returns a SAS token bound to it.
+// As a container has at most 5 stored access policies, it fails with clients.ErrAccessLimitReached
+// when granting a sixth access to the container.
+func (c *Client) CreateBucketAccess(ctx context.Context, bucket, userID string) (clients.User, error) {
+	acl, publicAccess, err := c.getACL(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get container ACL: %w", err)
+	}
+
+	id := identifier(userID)
+	now := c.now().UTC().Truncate(time.Second)
+	expiry := now.Add(sasValidity)
+	policy := signedIdentifier{
+		ID: id,
+		AccessPolicy: accessPolicy{
+			Start:      formatTime(now),
+			Expiry:     formatTime(expiry),
+			Permission: sasPermissions,
+		},
+	}
+
+	replaced := false
+	for i := range acl.Identifiers {
+		if acl.Identifiers[i].ID == id {
+			acl.Identifiers[i] = policy
+			replaced = true
+		}
+	}
+	if !replaced {
+		if len(acl.Identifiers) >= maxAccessPolicies {
+			return nil, fmt.Errorf("%w: container %s already has %d stored access policies",
+				clients.ErrAccessLimitReached, bucket, len(acl.Identifiers))
+		}
+		acl.Identifiers = append(acl.Identifiers, policy)
+	}
+
+	if err := c.setACL(ctx, bucket, acl, publicAccess); err != nil {
+		return nil, fmt.Errorf("unable to set container ACL: %w", err)
+	}
+
+	sas := ContainerSAS{
+		Account:    c.account,
+		Container:  bucket,
+		Identifier: id,
+	}
+
+	return &user{
+		name:   userID,
+		token:  sas.Sign(c.key).Encode(),
+		expiry: expiry,
+	}, nil
+}
+
+// DeleteBucketAccess removes the stored access policy of the user, which revokes its SAS token.
+// Missing containers and policies are not treated as errors.
+func (c *Client) DeleteBucketAccess(ctx context.Context, bucket, userID string) error {
+	acl, publicAccess, err := c.getACL(ctx, bucket)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get container ACL: %w", err)
+	}
+
+	id := identifier(userID)
+	kept := acl.Identifiers[:0]
+	for _, si := range acl.Identifiers {
+		if si.ID != id {
+			kept = append(kept, si)
+		}
+	}
+	if len(kept) == len(acl.Identifiers) {
+		return nil
+	}
+	acl.Identifiers = kept
+
+	if err := c.setACL(ctx, bucket, acl, publicAccess); err != nil {
+		return fmt.Errorf("unable to set container ACL: %w", err)
+	}
+
+	return nil
+}
+
+// ParameterSchema returns the BucketClass parameters supported by CreateBucket.
+func (c *Client) ParameterSchema() clients.Schema {
+	return schema
+}
+
+// NameRules returns the naming rules of Blob Storage containers.
+func (c *Client) NameRules() clients.NameRules {
+	return clients.AzureNameRules
+}
+
+// ProtocolInfo returns detailed information about protocol supported by the storage backend.
+func (c *Client) ProtocolInfo() *cosi.Protocol {
+	return &cosi.Protocol{
+		Type: &cosi.Protocol_AzureBlob{
+			AzureBlob: &cosi.AzureBlob{
+				StorageAccount: c.account,
+			},
+		},
+	}
+}
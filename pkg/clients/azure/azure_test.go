@@ -0,0 +1,442 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+// Well-known Azurite development account.
+const (
+	testAccount = "devstoreaccount1"
+	testKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+type container struct {
+	publicAccess string
+	metadata     http.Header
+	acl          []byte
+}
+
+// fakeBlobService is an httptest stand-in for the Blob service container API.
+type fakeBlobService struct {
+	mu         sync.Mutex
+	containers map[string]*container
+}
+
+func newFakeBlobService(t *testing.T) (*fakeBlobService, *Client) {
+	f := &fakeBlobService{containers: map[string]*container{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	client, err := New(testAccount, testKey, srv.URL+"/"+testAccount)
+	require.NoError(t, err)
+
+	return f, client
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("X-Ms-Error-Code", code)
+	w.WriteHeader(status)
+	fmt.Fprintf(w,
+		"<?xml version=\"1.0\" encoding=\"utf-8\"?><Error><Code>%s</Code><Message>%s</Message></Error>",
+		code, code,
+	)
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, _ := base64.StdEncoding.DecodeString(testKey)
+	if r.Header.Get("Authorization") != "SharedKey "+testAccount+":"+SharedKeySignature(r, testAccount, key) {
+		writeError(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/"+testAccount+"/")
+	if r.URL.Query().Get("restype") != "container" || strings.Contains(name, "/") {
+		writeError(w, http.StatusBadRequest, "UnsupportedQueryParameter")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, exists := f.containers[name]
+	if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" {
+		if exists {
+			writeError(w, http.StatusConflict, "ContainerAlreadyExists")
+			return
+		}
+		metadata := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Ms-Meta-") {
+				metadata[k] = v
+			}
+		}
+		f.containers[name] = &container{publicAccess: r.Header.Get("X-Ms-Blob-Public-Access"), metadata: metadata}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	if c.publicAccess != "" {
+		w.Header().Set("X-Ms-Blob-Public-Access", c.publicAccess)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("comp") == "":
+		maps.Copy(w.Header(), c.metadata)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodDelete:
+		delete(f.containers, name)
+		w.WriteHeader(http.StatusAccepted)
+
+	case r.Method == http.MethodGet && r.URL.Query().Get("comp") == "acl":
+		_, _ = w.Write(c.acl)
+
+	case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "acl":
+		c.acl, _ = io.ReadAll(r.Body)
+		c.publicAccess = r.Header.Get("X-Ms-Blob-Public-Access")
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		writeError(w, http.StatusBadRequest, "UnsupportedHttpVerb")
+	}
+}
+
+func (f *fakeBlobService) identifiers(t *testing.T, name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	acl := signedIdentifiers{}
+	if len(f.containers[name].acl) > 0 {
+		require.NoError(t, xml.Unmarshal(f.containers[name].acl, &acl))
+	}
+
+	ids := []string{}
+	for _, si := range acl.Identifiers {
+		ids = append(ids, si.ID)
+	}
+	return ids
+}
+
+// metadata returns the metadata headers of the container, nil if it does not exist.
+func (f *fakeBlobService) metadata(name string) http.Header {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.containers[name]
+	if !ok {
+		return nil
+	}
+	return c.metadata.Clone()
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		account     string
+		key         string
+		endpoint    string
+		expected    string
+		expectedErr string
+	}{
+		"default endpoint": {
+			account:  "account",
+			key:      testKey,
+			expected: "https://account.blob.core.windows.net",
+		},
+		"emulator endpoint": {
+			account:  testAccount,
+			key:      testKey,
+			endpoint: "http://127.0.0.1:10000/devstoreaccount1/",
+			expected: "http://127.0.0.1:10000/devstoreaccount1",
+		},
+		"missing account": {
+			key:         testKey,
+			expectedErr: "storage account name is required",
+		},
+		"invalid key": {
+			account:     "account",
+			key:         "not base64!",
+			expectedErr: "unable to decode storage account key",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, err := New(tc.account, tc.key, tc.endpoint)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, client.endpoint)
+		})
+	}
+}
+
+func TestClient_Buckets(t *testing.T) {
+	t.Parallel()
+
+	_, client := newFakeBlobService(t)
+	ctx := context.Background()
+
+	exists, err := client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", map[string]string{"publicAccess": "blob"}))
+
+	exists, err = client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	err = client.CreateBucket(ctx, "bucket", nil)
+	assert.ErrorContains(t, err, "ContainerAlreadyExists")
+	assert.ErrorIs(t, err, clients.ErrBucketAlreadyExists)
+
+	for params, expected := range map[string]bool{
+		"blob":      true,
+		"container": false,
+		"none":      false,
+		"unknown":   false,
+	} {
+		p := map[string]string{"publicAccess": params}
+		if params == "unknown" {
+			p = map[string]string{"publicAccess": "blob", "unknown": "value"}
+		}
+		equal, err := client.IsBucketEqual(ctx, "bucket", p)
+		require.NoError(t, err)
+		assert.Equal(t, expected, equal, params)
+	}
+
+	require.NoError(t, client.DeleteBucket(ctx, "bucket"))
+
+	exists, err = client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.ErrorIs(t, client.DeleteBucket(ctx, "bucket"), clients.ErrBucketNotFound)
+}
+
+func TestClient_CreateBucket_InvalidParameters(t *testing.T) {
+	t.Parallel()
+
+	_, client := newFakeBlobService(t)
+
+	err := client.CreateBucket(context.Background(), "bucket", map[string]string{"publicAccess": "everyone"})
+	assert.ErrorContains(t, err, `invalid publicAccess value: "everyone"`)
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+
+	err = client.CreateBucket(context.Background(), "bucket", map[string]string{"region": "west"})
+	assert.ErrorContains(t, err, `unsupported parameter: "region"`)
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_CreateBucket_Tags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	f, client := newFakeBlobService(t)
+
+	params := map[string]string{"tags": "team=storage,CostCenter=1234"}
+	require.NoError(t, client.CreateBucket(ctx, "bucket", params))
+	metadata := f.metadata("bucket")
+	assert.Equal(t, "storage", metadata.Get("X-Ms-Meta-Team"))
+	assert.Equal(t, "1234", metadata.Get("X-Ms-Meta-Costcenter"))
+
+	for tags, expected := range map[string]bool{
+		"team=storage,CostCenter=1234":  true,
+		"costcenter=1234, team=storage": true,
+		"team=storage":                  true,
+		"team=storage,env=prod":         false,
+		"team=finance,CostCenter=1234":  false,
+		"team":                          false,
+	} {
+		equal, err := client.IsBucketEqual(ctx, "bucket", map[string]string{"tags": tags})
+		require.NoError(t, err)
+		assert.Equal(t, expected, equal, tags)
+	}
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", nil)
+	require.NoError(t, err)
+	assert.True(t, equal, "metadata missing from the parameters is ignored")
+
+	for tags, expectedErr := range map[string]string{
+		"team":                               `invalid tag "team": must be key=value`,
+		"cost-center=1234":                   `invalid tag "cost-center": metadata names must be C# identifiers`,
+		"1team=a":                            `invalid tag "1team"`,
+		"team=a,Team=b":                      `duplicate tag "team": metadata names are case-insensitive`,
+		"team=caf\u00e9":                     `invalid value of tag "team": metadata values must be printable ASCII`,
+		"team=" + strings.Repeat("a", 8<<10): "tags exceed the 8192 bytes of container metadata",
+	} {
+		err := client.CreateBucket(ctx, "invalid", map[string]string{"tags": tags})
+		assert.ErrorContains(t, err, expectedErr)
+		assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+	}
+	assert.Nil(t, f.metadata("invalid"))
+}
+
+func TestClient_BucketAccess(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeBlobService(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	client.now = func() time.Time { return now }
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", map[string]string{"publicAccess": "container"}))
+
+	user, err := client.CreateBucketAccess(ctx, "bucket", "user-a")
+	require.NoError(t, err)
+	assert.Equal(t, "user-a", user.Name())
+	assert.Equal(t, "azure", user.Platform())
+	assert.Equal(t, "2025-01-01T03:04:05Z", user.Credentials()["expiryTimeStamp"])
+
+	token, err := url.ParseQuery(user.Credentials()["accessToken"])
+	require.NoError(t, err)
+	assert.Equal(t, "user-a", token.Get("si"))
+	assert.Equal(t, "c", token.Get("sr"))
+	assert.Equal(t, SASVersion, token.Get("sv"))
+
+	key, _ := base64.StdEncoding.DecodeString(testKey)
+	sas, err := ParseContainerSAS(testAccount, "bucket", token)
+	require.NoError(t, err)
+	assert.Equal(t, token.Get("sig"), sas.Signature(key))
+
+	_, err = client.CreateBucketAccess(ctx, "bucket", "user-b")
+	require.NoError(t, err)
+	_, err = client.CreateBucketAccess(ctx, "bucket", "user-a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-a", "user-b"}, f.identifiers(t, "bucket"))
+
+	require.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "user-a"))
+	assert.Equal(t, []string{"user-b"}, f.identifiers(t, "bucket"))
+
+	require.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "user-a"))
+	require.NoError(t, client.DeleteBucketAccess(ctx, "missing", "user-a"))
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", map[string]string{"publicAccess": "container"})
+	require.NoError(t, err)
+	assert.True(t, equal, "public access must survive ACL updates")
+}
+
+func TestClient_CreateBucketAccess_Limit(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeBlobService(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+	for i := range maxAccessPolicies {
+		_, err := client.CreateBucketAccess(ctx, "bucket", fmt.Sprintf("user-%d", i))
+		require.NoError(t, err)
+	}
+
+	_, err := client.CreateBucketAccess(ctx, "bucket", "user-5")
+	assert.ErrorContains(t, err, "container bucket already has 5 stored access policies")
+	assert.ErrorIs(t, err, clients.ErrAccessLimitReached)
+	assert.Len(t, f.identifiers(t, "bucket"), maxAccessPolicies)
+
+	_, err = client.CreateBucketAccess(ctx, "bucket", "user-0")
+	require.NoError(t, err, "existing accesses must still be renewed")
+}
+
+func TestIdentifier(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "user", identifier("user"))
+	assert.Equal(t, strings.Repeat("a", 64), identifier(strings.Repeat("a", 64)))
+
+	long := strings.Repeat("a", 70)
+	assert.Len(t, identifier(long+"-1"), maxIdentifierLength)
+	assert.True(t, strings.HasPrefix(identifier(long+"-1"), strings.Repeat("a", 47)+"-"))
+	assert.NotEqual(t, identifier(long+"-1"), identifier(long+"-2"))
+	assert.Equal(t, identifier(long+"-1"), identifier(long+"-1"))
+}
+
+func TestClient_CreateBucketAccess_MissingBucket(t *testing.T) {
+	t.Parallel()
+
+	_, client := newFakeBlobService(t)
+
+	_, err := client.CreateBucketAccess(context.Background(), "missing", "user")
+	assert.ErrorContains(t, err, "ContainerNotFound")
+	assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+}
+
+func TestClient_InvalidKey(t *testing.T) {
+	t.Parallel()
+
+	_, valid := newFakeBlobService(t)
+	client, err := New(testAccount, base64.StdEncoding.EncodeToString([]byte("wrong")), valid.endpoint)
+	require.NoError(t, err)
+
+	_, err = client.BucketExists(context.Background(), "bucket")
+	assert.ErrorIs(t, err, clients.ErrPermissionDenied)
+}
+
+func TestContainerSAS_Signature(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+	sas := ContainerSAS{
+		Account:     "account",
+		Container:   "container",
+		Permissions: "rl",
+		Expiry:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	expected := sign(key, "rl\n\n2024-01-02T03:04:05Z\n/blob/account/container\n\n\n\n2020-12-06\nc\n\n\n\n\n\n\n")
+	assert.Equal(t, expected, sas.Signature(key))
+
+	values := sas.Sign(key)
+	assert.Equal(t, "2024-01-02T03:04:05Z", values.Get("se"))
+	assert.Equal(t, expected, values.Get("sig"))
+	assert.Empty(t, values.Get("si"))
+}
+
+func TestClient_ProtocolInfo(t *testing.T) {
+	t.Parallel()
+
+	client, err := New("account", testKey, "")
+	require.NoError(t, err)
+
+	protocol := client.ProtocolInfo()
+	assert.IsType(t, &cosi.Protocol_AzureBlob{}, protocol.GetType())
+	assert.Equal(t, "account", protocol.GetAzureBlob().GetStorageAccount())
+}
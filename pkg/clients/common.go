@@ -34,4 +34,6 @@ type Client interface {
 	CreateBucketAccess(ctx context.Context, bucket, user string) (User, error)
 	DeleteBucketAccess(ctx context.Context, bucket, user string) error
 	ProtocolInfo() *cosi.Protocol
+	ParameterSchema() Schema
+	NameRules() NameRules
 }
@@ -0,0 +1,52 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import "errors"
+
+// Errors returned by clients, wrapping the backend errors they are mapped from,
+// so that callers can tell failures apart with errors.Is regardless of the backend.
+var (
+	// ErrInvalidParameters is returned by CreateBucket when the parameters of the BucketClass
+	// are not understood by the client, or have invalid values.
+	ErrInvalidParameters = errors.New("invalid bucket parameters")
+
+	// ErrInvalidBucketName is returned when a bucket name does not follow the naming rules of the backend.
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+
+	// ErrBucketNotFound is returned when the bucket does not exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrBucketAlreadyExists is returned when creating a bucket whose name is already taken.
+	ErrBucketAlreadyExists = errors.New("bucket already exists")
+
+	// ErrBucketNotEmpty is returned by DeleteBucket when the bucket still holds objects
+	// and the client was not allowed to remove them.
+	ErrBucketNotEmpty = errors.New("bucket not empty")
+
+	// ErrPermissionDenied is returned when the backend rejects the credentials of the driver,
+	// or does not allow them to perform the operation.
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrAccessLimitReached is returned by CreateBucketAccess when the bucket already has as many accesses
+	// as the backend allows.
+	ErrAccessLimitReached = errors.New("access limit reached")
+
+	// ErrNotSupported is returned when the client does not implement the operation for its backend.
+	ErrNotSupported = errors.New("operation not supported")
+
+	// ErrThrottled is returned when the backend is throttling requests or temporarily unavailable.
+	ErrThrottled = errors.New("throttled")
+)
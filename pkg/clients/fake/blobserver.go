@@ -0,0 +1,406 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/azure"
+)
+
+const defaultMaxResults = 5000
+
+// sasParams are the query parameters of a SAS token, which are not part of the operation.
+var sasParams = map[string]bool{
+	"sv":  true,
+	"sr":  true,
+	"si":  true,
+	"sp":  true,
+	"st":  true,
+	"se":  true,
+	"sip": true,
+	"spr": true,
+	"sig": true,
+}
+
+// blobServer serves a subset of the Blob service API backed by the buckets of the client:
+// getting the container properties, listing blobs, and block blob PUT, GET, HEAD and DELETE.
+// Requests are path style, /account/container/blob, and must carry a SAS token issued for an access
+// to the container they target. Block lists, copies, leases and snapshots are not implemented.
+type blobServer struct {
+	client  *Client
+	now     func() time.Time
+	started time.Time
+}
+
+func newBlobServer(c *Client) *blobServer {
+	return &blobServer{
+		client:  c,
+		now:     time.Now,
+		started: time.Now().UTC(),
+	}
+}
+
+// blobError is an error response of the Blob service API.
+type blobError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (s *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	account, container, blob := parts[0], parts[1], parts[2]
+
+	w.Header().Set("X-Ms-Version", azure.APIVersion)
+	if err := s.serve(w, r, account, container, blob); err != nil {
+		klog.V(4).InfoS("Blob request failed", "method", r.Method, "path", r.URL.Path, "code", err.Code)
+		writeBlobError(w, r, err)
+	}
+}
+
+func (s *blobServer) serve(w http.ResponseWriter, r *http.Request, account, container, blob string) *blobError {
+	if account != fakeStorageAccount {
+		return &blobError{http.StatusNotFound, "ResourceNotFound", "The specified account does not exist"}
+	}
+	if container == "" {
+		return &blobError{
+			http.StatusForbidden, "AuthorizationResourceTypeMismatch", "Only container and blob operations are allowed",
+		}
+	}
+
+	sas, err := s.authenticate(r, container)
+	if err != nil {
+		return err
+	}
+
+	query := operationParams(r)
+	restype, comp := query.Get("restype"), query.Get("comp")
+
+	switch {
+	case blob == "" && restype == "container" && comp == "list" && r.Method == http.MethodGet:
+		if err := authorize(sas, 'l'); err != nil {
+			return err
+		}
+		return s.listBlobs(w, container, query)
+
+	case blob == "" && restype == "container" && comp == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		if err := authorize(sas, 'r'); err != nil {
+			return err
+		}
+		if exists, _ := s.client.BucketExists(r.Context(), container); !exists {
+			return blobObjectError(clients.ErrBucketNotFound)
+		}
+		w.Header().Set("Last-Modified", s.started.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"`+strconv.FormatInt(s.started.UnixNano(), 16)+`"`)
+		w.WriteHeader(http.StatusOK)
+		return nil
+
+	case blob == "" || restype != "" || comp != "":
+		return &blobError{http.StatusNotImplemented, "NotImplemented", "The requested operation is not implemented"}
+
+	case r.Method == http.MethodPut:
+		if err := authorize(sas, 'c', 'w'); err != nil {
+			return err
+		}
+		return s.putBlob(w, r, container, blob)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		if err := authorize(sas, 'r'); err != nil {
+			return err
+		}
+		return s.getBlob(w, r, container, blob)
+
+	case r.Method == http.MethodDelete:
+		if err := authorize(sas, 'd'); err != nil {
+			return err
+		}
+		// unlike S3, deleting a missing blob fails
+		if _, err := s.client.getObject(container, blob); err != nil {
+			return blobObjectError(err)
+		}
+		if err := s.client.deleteObject(container, blob); err != nil {
+			return blobObjectError(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+
+	default:
+		return &blobError{http.StatusMethodNotAllowed, "UnsupportedHttpVerb", "The method is not allowed"}
+	}
+}
+
+// authenticate verifies the SAS token of the request against the account key, and that the access it was
+// issued for still exists, so that revoking the access invalidates the token.
+func (s *blobServer) authenticate(r *http.Request, container string) (azure.ContainerSAS, *blobError) {
+	query := r.URL.Query()
+	if query.Get("sig") == "" {
+		return azure.ContainerSAS{}, &blobError{
+			http.StatusForbidden, "NoAuthenticationInformation", "Anonymous access is not allowed",
+		}
+	}
+
+	failed := &blobError{http.StatusForbidden, "AuthenticationFailed", "The SAS token is not valid"}
+
+	sas, err := azure.ParseContainerSAS(fakeStorageAccount, container, query)
+	if err != nil || query.Get("sr") != "c" {
+		return azure.ContainerSAS{}, failed
+	}
+	signature := sas.Signature(s.client.accountKey())
+	if !hmac.Equal([]byte(signature), []byte(query.Get("sig"))) {
+		return azure.ContainerSAS{}, failed
+	}
+
+	now := s.now()
+	if sas.Expiry.IsZero() || now.After(sas.Expiry) || (!sas.Start.IsZero() && now.Before(sas.Start)) {
+		return azure.ContainerSAS{}, &blobError{http.StatusForbidden, "AuthenticationFailed", "The SAS token is expired"}
+	}
+
+	if _, ok := s.client.Access(container, sas.Identifier); !ok {
+		return azure.ContainerSAS{}, &blobError{
+			http.StatusForbidden, "AuthenticationFailed", "The access of the SAS token was revoked",
+		}
+	}
+
+	return sas, nil
+}
+
+// authorize checks that the SAS grants one of the permissions.
+func authorize(sas azure.ContainerSAS, permissions ...rune) *blobError {
+	for _, p := range permissions {
+		if strings.ContainsRune(sas.Permissions, p) {
+			return nil
+		}
+	}
+	return &blobError{
+		http.StatusForbidden, "AuthorizationPermissionMismatch",
+		"This request is not authorized to perform this operation using this permission",
+	}
+}
+
+// operationParams returns the query parameters of the request that are not part of the SAS token.
+func operationParams(r *http.Request) url.Values {
+	query := url.Values{}
+	for k, v := range r.URL.Query() {
+		if !sasParams[k] {
+			query[k] = v
+		}
+	}
+	return query
+}
+
+type blobEntry struct {
+	XMLName    xml.Name
+	Name       string          `xml:"Name"`
+	Properties *blobProperties `xml:"Properties"`
+}
+
+type blobProperties struct {
+	LastModified  string `xml:"Last-Modified"`
+	ETag          string `xml:"Etag"`
+	ContentLength int    `xml:"Content-Length"`
+	ContentType   string `xml:"Content-Type"`
+	ContentMD5    string `xml:"Content-MD5"`
+	BlobType      string `xml:"BlobType"`
+}
+
+func (s *blobServer) listBlobs(w http.ResponseWriter, container string, query url.Values) *blobError {
+	prefix, delimiter, marker := query.Get("prefix"), query.Get("delimiter"), query.Get("marker")
+
+	maxResults := defaultMaxResults
+	if v := query.Get("maxresults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return &blobError{http.StatusBadRequest, "OutOfRangeQueryParameterValue", "Invalid maxresults"}
+		}
+		maxResults = min(n, defaultMaxResults)
+	}
+
+	keys, objects, err := s.client.listObjects(container, prefix)
+	if err != nil {
+		return blobObjectError(err)
+	}
+
+	page, truncated := listPage(keys, prefix, delimiter, marker, maxResults)
+
+	entries := make([]blobEntry, 0, len(page))
+	for _, entry := range page {
+		if entry.Prefix {
+			entries = append(entries, blobEntry{XMLName: xml.Name{Local: "BlobPrefix"}, Name: entry.Key})
+			continue
+		}
+
+		o := objects[entry.Key]
+		entries = append(entries, blobEntry{
+			XMLName: xml.Name{Local: "Blob"},
+			Name:    entry.Key,
+			Properties: &blobProperties{
+				LastModified:  o.Modified.Format(http.TimeFormat),
+				ETag:          `"` + o.ETag + `"`,
+				ContentLength: len(o.Data),
+				ContentType:   o.ContentType,
+				ContentMD5:    contentMD5(o),
+				BlobType:      "BlockBlob",
+			},
+		})
+	}
+
+	result := struct {
+		XMLName       xml.Name `xml:"EnumerationResults"`
+		ContainerName string   `xml:"ContainerName,attr"`
+		Prefix        string   `xml:"Prefix,omitempty"`
+		Marker        string   `xml:"Marker,omitempty"`
+		MaxResults    int      `xml:"MaxResults"`
+		Delimiter     string   `xml:"Delimiter,omitempty"`
+		Blobs         struct {
+			Entries []blobEntry // Blob and BlobPrefix elements, named by their XMLName.
+		} `xml:"Blobs"`
+		NextMarker string `xml:"NextMarker"`
+	}{
+		ContainerName: container,
+		Prefix:        prefix,
+		Marker:        marker,
+		MaxResults:    maxResults,
+		Delimiter:     delimiter,
+		NextMarker:    nextMarker(page, truncated),
+	}
+	result.Blobs.Entries = entries
+
+	return writeBlobXML(w, http.StatusOK, result)
+}
+
+func (s *blobServer) putBlob(w http.ResponseWriter, r *http.Request, container, blob string) *blobError {
+	if t := r.Header.Get("X-Ms-Blob-Type"); t != "BlockBlob" {
+		return &blobError{http.StatusBadRequest, "InvalidHeaderValue", "Only block blobs are supported"}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxObjectSize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &blobError{http.StatusRequestEntityTooLarge, "RequestBodyTooLarge", "The blob exceeds the maximum size"}
+	case err != nil:
+		return &blobError{http.StatusBadRequest, "InvalidInput", err.Error()}
+	}
+
+	metadata := map[string]string{}
+	for k, v := range r.Header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-ms-meta-"); ok && len(v) > 0 {
+			metadata[name] = v[0]
+		}
+	}
+
+	contentType := r.Header.Get("X-Ms-Blob-Content-Type")
+	if contentType == "" {
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	o := newObject(body, contentType, metadata)
+	if err := s.client.putObject(container, blob, o); err != nil {
+		return blobObjectError(err)
+	}
+
+	w.Header().Set("ETag", `"`+o.ETag+`"`)
+	w.Header().Set("Last-Modified", o.Modified.Format(http.TimeFormat))
+	w.Header().Set("Content-MD5", contentMD5(o))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (s *blobServer) getBlob(w http.ResponseWriter, r *http.Request, container, blob string) *blobError {
+	o, err := s.client.getObject(container, blob)
+	if err != nil {
+		return blobObjectError(err)
+	}
+
+	w.Header().Set("ETag", `"`+o.ETag+`"`)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("X-Ms-Blob-Type", "BlockBlob")
+	w.Header().Set("Content-MD5", contentMD5(o))
+	if o.ContentType != "" {
+		w.Header().Set("Content-Type", o.ContentType)
+	}
+	for k, v := range o.Metadata {
+		w.Header().Set("X-Ms-Meta-"+k, v)
+	}
+
+	if rng := r.Header.Get("X-Ms-Range"); rng != "" {
+		r.Header.Set("Range", rng)
+	}
+
+	// ServeContent handles HEAD, range and conditional requests
+	http.ServeContent(w, r, blob, o.Modified, bytes.NewReader(o.Data))
+	return nil
+}
+
+// contentMD5 returns the base64 encoded MD5 of the object data, which is its hex encoded ETag.
+func contentMD5(o *object) string {
+	sum := md5.Sum(o.Data) // the Content-MD5 of blobs, not used for security
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func blobObjectError(err error) *blobError {
+	switch {
+	case errors.Is(err, clients.ErrBucketNotFound):
+		return &blobError{http.StatusNotFound, "ContainerNotFound", "The specified container does not exist"}
+	case errors.Is(err, errObjectNotFound):
+		return &blobError{http.StatusNotFound, "BlobNotFound", "The specified blob does not exist"}
+	default:
+		return &blobError{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+}
+
+func writeBlobXML(w http.ResponseWriter, status int, v any) *blobError {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return &blobError{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header)) //nolint:errcheck // best effort call
+	w.Write(data)               //nolint:errcheck // best effort call
+	return nil
+}
+
+func writeBlobError(w http.ResponseWriter, r *http.Request, err *blobError) {
+	w.Header().Set("X-Ms-Error-Code", err.Code)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.Status)
+		return
+	}
+
+	_ = writeBlobXML(w, err.Status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: err.Code, Message: err.Message})
+}
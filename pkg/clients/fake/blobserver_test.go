@@ -0,0 +1,325 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/azure"
+)
+
+// startBlobServer starts the embedded Blob server of a new fake client with the given containers.
+func startBlobServer(t *testing.T, containers ...string) (*Client, *blobServer, *httptest.Server) {
+	client := New("azure")
+	for _, c := range containers {
+		require.NoError(t, client.CreateBucket(context.Background(), c, nil))
+	}
+
+	srv := httptest.NewUnstartedServer(nil)
+	h, err := client.Handler("http://" + srv.Listener.Addr().String())
+	require.NoError(t, err)
+	srv.Config.Handler = h
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return client, h.(*blobServer), srv
+}
+
+// blobRequest sends a request for the path, relative to the endpoint in the credentials, using their SAS token.
+func blobRequest(
+	t *testing.T,
+	creds map[string]string,
+	method, path, query string,
+	body io.Reader,
+	header map[string]string,
+) *http.Response {
+	target := creds["endpoint"] + "/" + path + "?" + creds["accessToken"]
+	if query != "" {
+		target += "&" + query
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func accessCredentials(t *testing.T, client *Client, container, account string) map[string]string {
+	user, err := client.CreateBucketAccess(context.Background(), container, account)
+	require.NoError(t, err)
+	return user.Credentials()
+}
+
+func TestBlobServer_Blobs(t *testing.T) {
+	t.Parallel()
+
+	client, _, srv := startBlobServer(t, "container")
+	creds := accessCredentials(t, client, "container", "account")
+	assert.Equal(t, srv.URL+"/fake", creds["endpoint"])
+
+	resp := blobRequest(t, creds, http.MethodPut, "container/dir/hello.txt", "", strings.NewReader("hello world"),
+		map[string]string{"X-Ms-Blob-Type": "BlockBlob", "Content-Type": "text/plain", "X-Ms-Meta-Owner": "tests"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp = blobRequest(t, creds, http.MethodGet, "container/dir/hello.txt", "", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, "BlockBlob", resp.Header.Get("X-Ms-Blob-Type"))
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "tests", resp.Header.Get("X-Ms-Meta-Owner"))
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	resp = blobRequest(t, creds, http.MethodGet, "container/dir/hello.txt", "", nil,
+		map[string]string{"X-Ms-Range": "bytes=6-10"})
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	data, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	resp = blobRequest(t, creds, http.MethodHead, "container", "restype=container", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = blobRequest(t, creds, http.MethodDelete, "container/dir/hello.txt", "", nil, nil)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp = blobRequest(t, creds, http.MethodGet, "container/dir/hello.txt", "", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "BlobNotFound", resp.Header.Get("X-Ms-Error-Code"))
+
+	resp = blobRequest(t, creds, http.MethodDelete, "container/dir/hello.txt", "", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = blobRequest(t, creds, http.MethodPut, "container/page", "", strings.NewReader("data"),
+		map[string]string{"X-Ms-Blob-Type": "PageBlob"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestBlobServer_ListBlobs(t *testing.T) {
+	t.Parallel()
+
+	client, _, _ := startBlobServer(t, "container")
+	creds := accessCredentials(t, client, "container", "account")
+
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt"} {
+		resp := blobRequest(t, creds, http.MethodPut, "container/"+name, "", strings.NewReader(name),
+			map[string]string{"X-Ms-Blob-Type": "BlockBlob"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	type result struct {
+		Blobs []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blobs>Blob"`
+		Prefixes []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blobs>BlobPrefix"`
+		NextMarker string `xml:"NextMarker"`
+	}
+
+	list := func(query string) ([]string, string) {
+		resp := blobRequest(t, creds, http.MethodGet, "container", "restype=container&comp=list&"+query, nil, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var r result
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&r))
+		var names []string
+		for _, b := range r.Blobs {
+			names = append(names, b.Name)
+		}
+		for _, p := range r.Prefixes {
+			names = append(names, p.Name+" (prefix)")
+		}
+		return names, r.NextMarker
+	}
+
+	tests := map[string]struct {
+		query          string
+		expected       []string
+		expectedMarker string
+	}{
+		"flat": {
+			expected: []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt"},
+		},
+		"hierarchical": {
+			query:    "delimiter=/",
+			expected: []string{"a.txt", "e.txt", "dir/ (prefix)"},
+		},
+		"prefix": {
+			query:    "prefix=dir/&delimiter=/",
+			expected: []string{"dir/b.txt", "dir/c.txt", "dir/sub/ (prefix)"},
+		},
+		"first page": {
+			query:          "maxresults=2",
+			expected:       []string{"a.txt", "dir/b.txt"},
+			expectedMarker: "dir/b.txt",
+		},
+		"next page": {
+			query:    "maxresults=2&delimiter=/&marker=dir/",
+			expected: []string{"e.txt"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			names, marker := list(tc.query)
+			assert.Equal(t, tc.expected, names)
+			assert.Equal(t, tc.expectedMarker, marker)
+		})
+	}
+}
+
+func TestBlobServer_Authentication(t *testing.T) {
+	t.Parallel()
+
+	client, server, _ := startBlobServer(t, "container", "other")
+	creds := accessCredentials(t, client, "container", "account")
+
+	token, err := url.ParseQuery(creds["accessToken"])
+	require.NoError(t, err)
+
+	withToken := func(fn func(q url.Values)) map[string]string {
+		q := url.Values{}
+		for k, v := range token {
+			q[k] = v
+		}
+		fn(q)
+		out := map[string]string{"endpoint": creds["endpoint"], "accessToken": q.Encode()}
+		return out
+	}
+
+	tests := map[string]struct {
+		creds        map[string]string
+		path         string
+		expectedCode string
+	}{
+		"valid token": {
+			creds: creds,
+			path:  "container/blob",
+		},
+		"anonymous": {
+			creds:        withToken(func(q url.Values) { q.Del("sig") }),
+			path:         "container/blob",
+			expectedCode: "NoAuthenticationInformation",
+		},
+		"forged signature": {
+			creds:        withToken(func(q url.Values) { q.Set("sig", "Zm9yZ2Vk") }),
+			path:         "container/blob",
+			expectedCode: "AuthenticationFailed",
+		},
+		"extended permissions": {
+			creds:        withToken(func(q url.Values) { q.Set("sp", "racwdlx") }),
+			path:         "container/blob",
+			expectedCode: "AuthenticationFailed",
+		},
+		"other container": {
+			creds:        creds,
+			path:         "other/blob",
+			expectedCode: "AuthenticationFailed",
+		},
+		"restricted permissions": {
+			creds: func() map[string]string {
+				sas := azure.ContainerSAS{
+					Account:     fakeStorageAccount,
+					Container:   "container",
+					Identifier:  "account",
+					Permissions: "l",
+					Expiry:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+				}
+				return map[string]string{
+					"endpoint":    creds["endpoint"],
+					"accessToken": sas.Sign(client.accountKey()).Encode(),
+				}
+			}(),
+			path:         "container/blob",
+			expectedCode: "AuthorizationPermissionMismatch",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := blobRequest(t, tc.creds, http.MethodPut, tc.path, "", strings.NewReader("data"),
+				map[string]string{"X-Ms-Blob-Type": "BlockBlob"})
+			if tc.expectedCode == "" {
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				return
+			}
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Equal(t, tc.expectedCode, resp.Header.Get("X-Ms-Error-Code"))
+		})
+	}
+
+	t.Run("expired token", func(t *testing.T) {
+		expired := *server
+		expired.now = func() time.Time { return time.Now().Add(2 * sasValidity) }
+
+		req := httptest.NewRequest(http.MethodGet, "/fake/container/blob?"+creds["accessToken"], nil)
+		rec := httptest.NewRecorder()
+		expired.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, "AuthenticationFailed", rec.Header().Get("X-Ms-Error-Code"))
+	})
+}
+
+func TestBlobServer_RevokedAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _, _ := startBlobServer(t, "container")
+	creds := accessCredentials(t, client, "container", "account")
+
+	resp := blobRequest(t, creds, http.MethodGet, "container", "restype=container&comp=list", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, client.DeleteBucketAccess(ctx, "container", "account"))
+
+	resp = blobRequest(t, creds, http.MethodGet, "container", "restype=container&comp=list", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "AuthenticationFailed", resp.Header.Get("X-Ms-Error-Code"))
+}
+
+func TestBlobServer_DeletedContainer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _, _ := startBlobServer(t, "container")
+	creds := accessCredentials(t, client, "container", "account")
+
+	require.NoError(t, client.DeleteBucket(ctx, "container"))
+
+	resp := blobRequest(t, creds, http.MethodGet, "container", "restype=container&comp=list", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "ContainerNotFound", resp.Header.Get("X-Ms-Error-Code"))
+}
@@ -16,11 +16,15 @@ package fake
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
 )
 
 func TestClient_CreateBucket(t *testing.T) {
@@ -55,7 +59,7 @@ func TestClient_CreateBucket(t *testing.T) {
 			err := client.CreateBucket(context.Background(), tc.bucketName, tc.parameters)
 			assert.NoError(t, err)
 
-			bucket, exists := client.Buckets[tc.bucketName]
+			bucket, exists := client.Buckets()[tc.bucketName]
 			assert.True(t, exists)
 			assert.Equal(t, tc.parameters, bucket.Parameters)
 		})
@@ -135,12 +139,34 @@ func TestClient_IsBucketEqual(t *testing.T) {
 			},
 			expected: false,
 		},
+		"tags missing from the parameters": {
+			platform:    "s3",
+			bucketName:  "test-bucket",
+			parameters:  map[string]string{"tags": "cluster=prod,team=storage"},
+			equalParams: map[string]string{"tags": "team=storage"},
+			expected:    true,
+		},
+		"different tags": {
+			platform:    "azure",
+			bucketName:  "test-bucket",
+			parameters:  map[string]string{"tags": "cluster=prod,team=storage"},
+			equalParams: map[string]string{"tags": "team=finance"},
+			expected:    false,
+		},
+		"missing bucket": {
+			platform:    "s3",
+			bucketName:  "",
+			equalParams: map[string]string{},
+			expected:    false,
+		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			client := New(tc.platform)
-			_ = client.CreateBucket(context.Background(), tc.bucketName, tc.parameters)
+			if tc.bucketName != "" {
+				_ = client.CreateBucket(context.Background(), tc.bucketName, tc.parameters)
+			}
 
 			equal, err := client.IsBucketEqual(context.Background(), tc.bucketName, tc.equalParams)
 			assert.NoError(t, err)
@@ -149,6 +175,89 @@ func TestClient_IsBucketEqual(t *testing.T) {
 	}
 }
 
+func TestClient_Tags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := New("s3")
+
+	assert.NoError(t, client.CreateBucket(ctx, "bucket", map[string]string{"tags": "team=storage", "param1": "value1"}))
+	bucket := client.Buckets()["bucket"]
+	assert.Equal(t, map[string]string{"team": "storage"}, bucket.Tags)
+	assert.Equal(t, map[string]string{"param1": "value1"}, bucket.Parameters)
+
+	err := client.CreateBucket(ctx, "invalid", map[string]string{"tags": "team"})
+	assert.ErrorContains(t, err, `invalid tags value: invalid tag "team"`)
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_Lifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	params := map[string]string{"expireAfterDays": "30", "abortIncompleteUploadAfterDays": "7"}
+	expected := clients.Lifecycle{ExpireAfterDays: 30, AbortIncompleteUploadAfterDays: 7}
+
+	client := New("s3")
+	assert.NoError(t, client.CreateBucket(ctx, "bucket", params))
+	assert.Equal(t, expected, client.Buckets()["bucket"].Lifecycle)
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", params)
+	assert.NoError(t, err)
+	assert.True(t, equal)
+
+	// rules changed outside of the driver are detected
+	assert.NoError(t, client.SetLifecycle("bucket", clients.Lifecycle{ExpireAfterDays: 60}))
+	equal, err = client.IsBucketEqual(ctx, "bucket", params)
+	assert.NoError(t, err)
+	assert.False(t, equal)
+
+	assert.ErrorIs(t, client.SetLifecycle("missing", expected), clients.ErrBucketNotFound)
+
+	err = client.CreateBucket(ctx, "invalid", map[string]string{"transitionStorageClass": "GLACIER"})
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+	assert.NotContains(t, client.Buckets(), "invalid")
+
+	// other platforms do not record lifecycle rules
+	azure := New("azure")
+	assert.NoError(t, azure.CreateBucket(ctx, "bucket", map[string]string{"transitionStorageClass": "GLACIER"}))
+	assert.Zero(t, azure.Buckets()["bucket"].Lifecycle)
+}
+
+func TestClient_Quota(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	params := map[string]string{"quota": "10Gi"}
+
+	client := New("s3")
+	assert.NoError(t, client.CreateBucket(ctx, "bucket", params))
+	assert.Equal(t, int64(10<<30), client.Buckets()["bucket"].Quota)
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", params)
+	assert.NoError(t, err)
+	assert.True(t, equal)
+
+	// quotas changed outside of the driver are detected
+	assert.NoError(t, client.SetQuota("bucket", 1<<30))
+	equal, err = client.IsBucketEqual(ctx, "bucket", params)
+	assert.NoError(t, err)
+	assert.False(t, equal)
+
+	assert.ErrorIs(t, client.SetQuota("missing", 1<<30), clients.ErrBucketNotFound)
+
+	for _, quota := range []string{"10GB", "0"} {
+		err = client.CreateBucket(ctx, "invalid", map[string]string{"quota": quota})
+		assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+		assert.NotContains(t, client.Buckets(), "invalid")
+	}
+
+	// other platforms do not record quotas
+	azure := New("azure")
+	assert.NoError(t, azure.CreateBucket(ctx, "bucket", params))
+	assert.Zero(t, azure.Buckets()["bucket"].Quota)
+}
+
 func TestClient_DeleteBucket(t *testing.T) {
 	t.Parallel()
 
@@ -174,7 +283,7 @@ func TestClient_DeleteBucket(t *testing.T) {
 			err := client.DeleteBucket(context.Background(), tc.bucketName)
 			assert.NoError(t, err)
 
-			_, exists := client.Buckets[tc.bucketName]
+			_, exists := client.Buckets()[tc.bucketName]
 			assert.False(t, exists)
 		})
 	}
@@ -199,7 +308,13 @@ func TestClient_CreateBucketAccess(t *testing.T) {
 			platform:       "azure",
 			bucketName:     "test-bucket",
 			accessName:     "test-access",
-			credentialKeys: []string{"accessToken"},
+			credentialKeys: []string{"accessToken", "expiryTimeStamp"},
+		},
+		"gcs platform": {
+			platform:       "gcs",
+			bucketName:     "test-bucket",
+			accessName:     "test-access",
+			credentialKeys: []string{"projectId", "serviceAccount"},
 		},
 	}
 
@@ -219,6 +334,20 @@ func TestClient_CreateBucketAccess(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("gcs service account key", func(t *testing.T) {
+		client := New("gcs")
+		_ = client.CreateBucket(context.Background(), "test-bucket", nil)
+		user, err := client.CreateBucketAccess(context.Background(), "test-bucket", "test-access")
+		assert.NoError(t, err)
+
+		key := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(user.Credentials()["serviceAccount"]), &key))
+		assert.Equal(t, "service_account", key["type"])
+		assert.Equal(t, "fake", key["project_id"])
+		assert.NotEmpty(t, key["private_key_id"])
+		assert.Contains(t, key["private_key"], "BEGIN PRIVATE KEY")
+	})
 }
 
 func TestClient_DeleteBucketAccess(t *testing.T) {
@@ -250,12 +379,144 @@ func TestClient_DeleteBucketAccess(t *testing.T) {
 			err := client.DeleteBucketAccess(context.Background(), tc.bucketName, tc.accessName)
 			assert.NoError(t, err)
 
-			_, exists := client.Accesses[tc.accessName]
+			_, exists := client.Access(tc.bucketName, tc.accessName)
 			assert.False(t, exists)
 		})
 	}
 }
 
+func TestClient_CreateBucketAccessIdempotent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := New("s3")
+	_ = client.CreateBucket(ctx, "bucket-a", nil)
+	_ = client.CreateBucket(ctx, "bucket-b", nil)
+
+	first, err := client.CreateBucketAccess(ctx, "bucket-a", "account")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Credentials(), first.Credentials(), "credentials must not change between calls")
+
+	again, err := client.CreateBucketAccess(ctx, "bucket-a", "account")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Credentials(), again.Credentials(), "granting again must return the same credentials")
+
+	other, err := client.CreateBucketAccess(ctx, "bucket-b", "account")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Credentials(), other.Credentials(), "each bucket must get its own credentials")
+
+	access, ok := client.Access("bucket-a", "account")
+	assert.True(t, ok)
+	assert.Equal(t, first.Credentials(), access.Credentials)
+
+	_, err = client.CreateBucketAccess(ctx, "missing", "account")
+	assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+	_, ok = client.Access("missing", "account")
+	assert.False(t, ok)
+}
+
+func TestClient_DeleteBucketAccessScopedToBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := New("s3")
+	_ = client.CreateBucket(ctx, "bucket-a", nil)
+	_ = client.CreateBucket(ctx, "bucket-b", nil)
+	_, _ = client.CreateBucketAccess(ctx, "bucket-a", "account")
+	_, _ = client.CreateBucketAccess(ctx, "bucket-b", "account")
+
+	assert.NoError(t, client.DeleteBucketAccess(ctx, "bucket-a", "account"))
+
+	_, ok := client.Access("bucket-a", "account")
+	assert.False(t, ok, "revoked credentials must be gone")
+	_, ok = client.Access("bucket-b", "account")
+	assert.True(t, ok, "access to other buckets must be kept")
+
+	// revoking again, or revoking an unknown access, succeeds
+	assert.NoError(t, client.DeleteBucketAccess(ctx, "bucket-a", "account"))
+	assert.NoError(t, client.DeleteBucketAccess(ctx, "missing", "account"))
+
+	// granting again after revocation issues new credentials
+	_, err := client.CreateBucketAccess(ctx, "bucket-a", "account")
+	assert.NoError(t, err)
+}
+
+func TestClient_Snapshots(t *testing.T) {
+	t.Parallel()
+
+	client := New("s3")
+	params := map[string]string{"param1": "value1"}
+	_ = client.CreateBucket(context.Background(), "test-bucket", params)
+	_, _ = client.CreateBucketAccess(context.Background(), "test-bucket", "test-access")
+
+	// mutating the caller's parameters or a snapshot must not affect the stored state
+	params["param1"] = "changed"
+	client.Buckets()["test-bucket"].Parameters["param1"] = "changed"
+	client.Accesses()[0].Credentials["accessKeyId"] = "changed"
+
+	assert.Equal(t, map[string]Bucket{
+		"test-bucket": {Parameters: map[string]string{"param1": "value1"}},
+	}, client.Buckets())
+	accesses := client.Accesses()
+	assert.Len(t, accesses, 1)
+	assert.Equal(t, "test-bucket", accesses[0].Bucket)
+	assert.Equal(t, "test-access", accesses[0].Account)
+	assert.NotEqual(t, "changed", accesses[0].Credentials["accessKeyId"])
+}
+
+// TestClient_Concurrent issues interleaved calls from many goroutines. Run with -race.
+func TestClient_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	const (
+		workers    = 16
+		iterations = 100
+	)
+
+	client := New("s3")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range iterations {
+				// a few shared names make workers contend for the same entries
+				bucket := fmt.Sprintf("bucket-%d", (w+i)%4)
+				access := fmt.Sprintf("access-%d-%d", w, i%4)
+				params := map[string]string{"worker": fmt.Sprint(w)}
+
+				assert.NoError(t, client.CreateBucket(ctx, bucket, params))
+				_, err := client.BucketExists(ctx, bucket)
+				assert.NoError(t, err)
+				_, err = client.IsBucketEqual(ctx, bucket, params)
+				assert.NoError(t, err)
+
+				// another worker may have deleted the bucket in the meantime
+				user, err := client.CreateBucketAccess(ctx, bucket, access)
+				if err == nil {
+					assert.NotEmpty(t, user.Credentials())
+				} else {
+					assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+				}
+
+				_ = client.Buckets()
+				_ = client.Accesses()
+
+				assert.NoError(t, client.DeleteBucketAccess(ctx, bucket, access))
+				if i%3 == 0 {
+					assert.NoError(t, client.DeleteBucket(ctx, bucket))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, client.Accesses())
+}
+
 func TestClient_ProtocolInfo(t *testing.T) {
 	t.Parallel()
 
@@ -271,6 +532,10 @@ func TestClient_ProtocolInfo(t *testing.T) {
 			platform:     "azure",
 			protocolType: &cosi.Protocol_AzureBlob{},
 		},
+		"gcs platform": {
+			platform:     "gcs",
+			protocolType: &cosi.Protocol_Gcs{},
+		},
 	}
 
 	for name, tc := range tests {
@@ -0,0 +1,187 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+var (
+	// errObjectNotFound is returned when reading an object that does not exist.
+	errObjectNotFound = errors.New("object not found")
+
+	// errQuotaExceeded is returned when storing an object would exceed the quota of the bucket.
+	errQuotaExceeded = errors.New("bucket quota exceeded")
+)
+
+// object is an object stored in a bucket by the embedded storage servers.
+// Objects are kept in memory only, they are not part of the persisted state.
+type object struct {
+	Data        []byte
+	ContentType string
+	Metadata    map[string]string
+	Modified    time.Time
+	ETag        string // Hex encoded MD5 of the data.
+}
+
+func newObject(data []byte, contentType string, metadata map[string]string) *object {
+	sum := md5.Sum(data) // the ETag of S3 objects, not used for security
+	return &object{
+		Data:        data,
+		ContentType: contentType,
+		Metadata:    metadata,
+		Modified:    time.Now().UTC(),
+		ETag:        hex.EncodeToString(sum[:]),
+	}
+}
+
+// putObject stores an object, replacing an existing object with the same key.
+// It fails with errQuotaExceeded if the objects of the bucket would exceed its quota.
+func (c *Client) putObject(bucket, key string, o *object) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.state.Buckets[bucket]
+	if !ok {
+		return fmt.Errorf("%w: %s", clients.ErrBucketNotFound, bucket)
+	}
+
+	if b.Quota > 0 {
+		size := int64(len(o.Data))
+		for k, existing := range c.objects[bucket] {
+			if k != key {
+				size += int64(len(existing.Data))
+			}
+		}
+		if size > b.Quota {
+			return fmt.Errorf("%w: %s would hold %d bytes, the quota is %d", errQuotaExceeded, bucket, size, b.Quota)
+		}
+	}
+
+	if c.objects[bucket] == nil {
+		c.objects[bucket] = map[string]*object{}
+	}
+	c.objects[bucket][key] = o
+
+	return nil
+}
+
+// getObject returns a stored object.
+func (c *Client) getObject(bucket, key string) (*object, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.state.Buckets[bucket]; !ok {
+		return nil, fmt.Errorf("%w: %s", clients.ErrBucketNotFound, bucket)
+	}
+
+	o, ok := c.objects[bucket][key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", errObjectNotFound, bucket, key)
+	}
+
+	out := *o
+	out.Metadata = maps.Clone(o.Metadata)
+	return &out, nil
+}
+
+// deleteObject removes a stored object. Deleting an object that does not exist succeeds.
+func (c *Client) deleteObject(bucket, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.state.Buckets[bucket]; !ok {
+		return fmt.Errorf("%w: %s", clients.ErrBucketNotFound, bucket)
+	}
+
+	delete(c.objects[bucket], key)
+	return nil
+}
+
+// listObjects returns the objects of the bucket whose key starts with prefix, ordered by key.
+func (c *Client) listObjects(bucket, prefix string) ([]string, map[string]*object, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.state.Buckets[bucket]; !ok {
+		return nil, nil, fmt.Errorf("%w: %s", clients.ErrBucketNotFound, bucket)
+	}
+
+	objects := map[string]*object{}
+	for key, o := range c.objects[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			objects[key] = o
+		}
+	}
+
+	return slices.Sorted(maps.Keys(objects)), objects, nil
+}
+
+// listing is an entry of a page of listed objects, either an object key or a common prefix.
+type listing struct {
+	Key    string
+	Prefix bool // Whether Key is a common prefix, ending with the delimiter.
+}
+
+// listPage returns up to limit entries following marker of the sorted keys starting with prefix.
+// With a delimiter, the keys sharing the part up to the delimiter after the prefix are grouped in a common prefix.
+// It also reports whether entries were left out because of the limit.
+func listPage(keys []string, prefix, delimiter, marker string, limit int) ([]listing, bool) {
+	var (
+		page []listing
+		last string
+	)
+	for _, key := range keys {
+		if key <= marker || (delimiter != "" && strings.HasSuffix(marker, delimiter) && strings.HasPrefix(key, marker)) {
+			continue
+		}
+
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry == last {
+			continue // further key of the same common prefix
+		}
+
+		if len(page) == limit {
+			return page, true
+		}
+
+		last = entry
+		page = append(page, listing{Key: entry, Prefix: entry != key})
+	}
+
+	return page, false
+}
+
+// nextMarker returns the marker to continue a truncated listing from.
+func nextMarker(page []listing, truncated bool) string {
+	if !truncated || len(page) == 0 {
+		return ""
+	}
+	return page[len(page)-1].Key
+}
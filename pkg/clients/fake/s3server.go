@@ -0,0 +1,435 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/sigv4"
+)
+
+const (
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	// maxClockSkew is how far the X-Amz-Date of a request may be from the server time.
+	maxClockSkew = 15 * time.Minute
+
+	// maxObjectSize limits the size of objects, which are kept in memory.
+	maxObjectSize = 64 << 20
+
+	defaultMaxKeys = 1000
+)
+
+// listParams are the query parameters accepted by the list objects operations.
+var listParams = map[string]bool{
+	"list-type":          true,
+	"prefix":             true,
+	"delimiter":          true,
+	"max-keys":           true,
+	"continuation-token": true,
+	"start-after":        true,
+	"marker":             true,
+	"fetch-owner":        true,
+	"encoding-type":      true,
+	"metadata":           true,
+}
+
+// s3Server serves a subset of the S3 API backed by the buckets of the client:
+// listing buckets, getting the bucket location, listing objects, and object PUT, GET, HEAD and DELETE.
+// Requests are path style and must be signed with SigV4 using the credentials of an access to the
+// bucket they target. Multipart uploads, copies and bucket subresources are not implemented.
+type s3Server struct {
+	client  *Client
+	now     func() time.Time
+	started time.Time
+}
+
+func newS3Server(c *Client) *s3Server {
+	return &s3Server{
+		client:  c,
+		now:     time.Now,
+		started: time.Now().UTC(),
+	}
+}
+
+// s3Error is an error response of the S3 API.
+type s3Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if err := s.serve(w, r, bucket, key); err != nil {
+		klog.V(4).InfoS("S3 request failed", "method", r.Method, "path", r.URL.Path, "code", err.Code)
+		writeS3Error(w, r, err)
+	}
+}
+
+func (s *s3Server) serve(w http.ResponseWriter, r *http.Request, bucket, key string) *s3Error {
+	body, access, err := s.authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return s.listBuckets(w, r, access)
+
+	case bucket == "":
+		return &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "Only listing buckets is supported"}
+
+	case access.Bucket != bucket:
+		return &s3Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+
+	case key == "" && r.Method == http.MethodHead && len(query) == 0:
+		if exists, _ := s.client.BucketExists(r.Context(), bucket); !exists {
+			return objectError(clients.ErrBucketNotFound)
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+
+	case key == "" && r.Method == http.MethodGet && query.Has("location"):
+		return writeXML(w, http.StatusOK, struct {
+			XMLName  xml.Name `xml:"LocationConstraint"`
+			Xmlns    string   `xml:"xmlns,attr"`
+			Location string   `xml:",chardata"`
+		}{Xmlns: s3Namespace, Location: fakeRegion})
+
+	case key == "" && r.Method == http.MethodGet && onlyListParams(query):
+		return s.listObjects(w, bucket, query)
+
+	case key == "" || len(query) > 0:
+		return &s3Error{http.StatusNotImplemented, "NotImplemented", "The requested operation is not implemented"}
+
+	case r.Method == http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return &s3Error{http.StatusNotImplemented, "NotImplemented", "Copying objects is not implemented"}
+		}
+		return s.putObject(w, r, bucket, key, body)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return s.getObject(w, r, bucket, key)
+
+	case r.Method == http.MethodDelete:
+		if err := s.client.deleteObject(bucket, key); err != nil {
+			return objectError(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+
+	default:
+		return &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed"}
+	}
+}
+
+// authenticate verifies the SigV4 signature of the request against the credentials issued for accesses,
+// and returns the verified body along with the access the credentials belong to.
+func (s *s3Server) authenticate(r *http.Request) ([]byte, *Access, *s3Error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil, &s3Error{http.StatusForbidden, "AccessDenied", "Anonymous access is not allowed"}
+	}
+
+	auth, err := sigv4.ParseAuthorization(header)
+	if err != nil || auth.Service != "s3" {
+		return nil, nil, &s3Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", fmt.Sprint(err)}
+	}
+
+	access, ok := s.client.accessByKeyID(auth.AccessKeyID)
+	if !ok {
+		return nil, nil, &s3Error{http.StatusForbidden, "InvalidAccessKeyId", "The access key ID does not exist"}
+	}
+
+	date, err := time.Parse(sigv4.TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil || date.Format(sigv4.DateFormat) != auth.Date {
+		return nil, nil, &s3Error{http.StatusForbidden, "AccessDenied", "A valid X-Amz-Date header is required"}
+	}
+	if skew := s.now().Sub(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return nil, nil, &s3Error{http.StatusForbidden, "RequestTimeTooSkewed", "The request time is too skewed"}
+	}
+
+	secret := access.Credentials["accessSecretKey"]
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return nil, nil, &s3Error{http.StatusBadRequest, "InvalidRequest", "Missing X-Amz-Content-Sha256 header"}
+	}
+
+	signature := sigv4.Signature(r, auth.SignedHeaders, payloadHash, secret, auth.Region, auth.Service, date)
+	if !hmac.Equal([]byte(signature), []byte(auth.Signature)) {
+		return nil, nil, &s3Error{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature does not match"}
+	}
+
+	reader := http.MaxBytesReader(nil, r.Body, maxObjectSize+maxObjectSize/8)
+
+	var body []byte
+	switch payloadHash {
+	case sigv4.StreamingPayload:
+		key := sigv4.SigningKey(secret, auth.Region, auth.Service, date)
+		body, err = sigv4.ReadChunked(reader, key, date, auth.Scope(), auth.Signature)
+	case sigv4.UnsignedPayload:
+		body, err = io.ReadAll(reader)
+	default:
+		body, err = io.ReadAll(reader)
+		if err == nil && sigv4.HashHex(body) != payloadHash {
+			return nil, nil, &s3Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The payload hash does not match"}
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge) || len(body) > maxObjectSize:
+		return nil, nil, &s3Error{http.StatusBadRequest, "EntityTooLarge", "The object exceeds the maximum size"}
+	case err != nil:
+		return nil, nil, &s3Error{http.StatusForbidden, "SignatureDoesNotMatch", err.Error()}
+	}
+
+	return body, access, nil
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter, r *http.Request, access *Access) *s3Error {
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+
+	var buckets []bucket
+	if exists, _ := s.client.BucketExists(r.Context(), access.Bucket); exists {
+		buckets = append(buckets, bucket{
+			Name:         access.Bucket,
+			CreationDate: s.started.Format(time.RFC3339),
+		})
+	}
+
+	return writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID string `xml:"ID"`
+		} `xml:"Owner"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace, Buckets: buckets})
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjects implements both ListObjects (V1) and ListObjectsV2.
+func (s *s3Server) listObjects(w http.ResponseWriter, bucket string, query map[string][]string) *s3Error {
+	get := func(k string) string {
+		if v := query[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	v2 := get("list-type") == "2"
+	prefix, delimiter := get("prefix"), get("delimiter")
+
+	maxKeys := defaultMaxKeys
+	if v := get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return &s3Error{http.StatusBadRequest, "InvalidArgument", "Invalid max-keys"}
+		}
+		maxKeys = min(n, defaultMaxKeys)
+	}
+
+	marker := get("marker")
+	if v2 {
+		marker = get("start-after")
+		if token := get("continuation-token"); token != "" {
+			marker = token
+		}
+	}
+
+	keys, objects, err := s.client.listObjects(bucket, prefix)
+	if err != nil {
+		return objectError(err)
+	}
+
+	page, truncated := listPage(keys, prefix, delimiter, marker, maxKeys)
+
+	var (
+		contents []listEntry
+		prefixes []commonPrefix
+	)
+	for _, entry := range page {
+		if entry.Prefix {
+			prefixes = append(prefixes, commonPrefix{Prefix: entry.Key})
+			continue
+		}
+
+		o := objects[entry.Key]
+		contents = append(contents, listEntry{
+			Key:          entry.Key,
+			LastModified: o.Modified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + o.ETag + `"`,
+			Size:         len(o.Data),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	result := struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		Xmlns                 string         `xml:"xmlns,attr"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		Delimiter             string         `xml:"Delimiter,omitempty"`
+		MaxKeys               int            `xml:"MaxKeys"`
+		KeyCount              int            `xml:"KeyCount,omitempty"`
+		Marker                string         `xml:"Marker,omitempty"`
+		NextMarker            string         `xml:"NextMarker,omitempty"`
+		ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		StartAfter            string         `xml:"StartAfter,omitempty"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		Contents              []listEntry    `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}{
+		Xmlns:          s3Namespace,
+		Name:           bucket,
+		Prefix:         prefix,
+		Delimiter:      delimiter,
+		MaxKeys:        maxKeys,
+		IsTruncated:    truncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	}
+
+	if v2 {
+		result.KeyCount = len(contents) + len(prefixes)
+		result.ContinuationToken = get("continuation-token")
+		result.StartAfter = get("start-after")
+		result.NextContinuationToken = nextMarker(page, truncated)
+	} else {
+		result.Marker = marker
+		result.NextMarker = nextMarker(page, truncated)
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string, body []byte) *s3Error {
+	metadata := map[string]string{}
+	for k, v := range r.Header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok && len(v) > 0 {
+			metadata[name] = v[0]
+		}
+	}
+
+	o := newObject(body, r.Header.Get("Content-Type"), metadata)
+	if err := s.client.putObject(bucket, key, o); err != nil {
+		return objectError(err)
+	}
+
+	w.Header().Set("ETag", `"`+o.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) *s3Error {
+	o, err := s.client.getObject(bucket, key)
+	if err != nil {
+		return objectError(err)
+	}
+
+	w.Header().Set("ETag", `"`+o.ETag+`"`)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if o.ContentType != "" {
+		w.Header().Set("Content-Type", o.ContentType)
+	}
+	for k, v := range o.Metadata {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+
+	// ServeContent handles HEAD, range and conditional requests
+	http.ServeContent(w, r, key, o.Modified, bytes.NewReader(o.Data))
+	return nil
+}
+
+func onlyListParams(query map[string][]string) bool {
+	for k := range query {
+		if !listParams[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func objectError(err error) *s3Error {
+	switch {
+	case errors.Is(err, clients.ErrBucketNotFound):
+		return &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	case errors.Is(err, errObjectNotFound):
+		return &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist"}
+	case errors.Is(err, errQuotaExceeded):
+		// as MinIO reports hard quotas
+		return &s3Error{http.StatusBadRequest, "XMinioAdminBucketQuotaExceeded", "Bucket quota exceeded"}
+	default:
+		return &s3Error{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) *s3Error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return &s3Error{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header)) //nolint:errcheck // best effort call
+	w.Write(data)               //nolint:errcheck // best effort call
+	return nil
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, err *s3Error) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.Status)
+		return
+	}
+
+	_ = writeXML(w, err.Status, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Resource string   `xml:"Resource"`
+	}{Code: err.Code, Message: err.Message, Resource: r.URL.Path})
+}
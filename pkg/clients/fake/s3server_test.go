@@ -0,0 +1,302 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startS3Server starts the embedded S3 server of a new fake client with the given bucket.
+func startS3Server(t *testing.T, buckets ...string) (*Client, *httptest.Server) {
+	client := New("s3")
+	for _, b := range buckets {
+		require.NoError(t, client.CreateBucket(context.Background(), b, nil))
+	}
+
+	srv := httptest.NewUnstartedServer(nil)
+	h, err := client.Handler("http://" + srv.Listener.Addr().String())
+	require.NoError(t, err)
+	srv.Config.Handler = h
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return client, srv
+}
+
+// minioFor returns a MinIO client configured from the credentials of a new access to the bucket.
+func minioFor(t *testing.T, client *Client, bucket, account string) (*minio.Client, map[string]string) {
+	user, err := client.CreateBucketAccess(context.Background(), bucket, account)
+	require.NoError(t, err)
+
+	creds := user.Credentials()
+	return newMinio(t, creds["endpoint"], creds["accessKeyId"], creds["accessSecretKey"]), creds
+}
+
+func newMinio(t *testing.T, endpoint, id, secret string) *minio.Client {
+	mc, err := minio.New(strings.TrimPrefix(endpoint, "http://"), &minio.Options{
+		Creds: credentials.NewStaticV4(id, secret, ""),
+	})
+	require.NoError(t, err)
+	return mc
+}
+
+func TestS3Server_Objects(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, srv := startS3Server(t, "bucket")
+	mc, creds := minioFor(t, client, "bucket", "account")
+	assert.Equal(t, srv.URL, creds["endpoint"])
+
+	content := []byte("hello world")
+	info, err := mc.PutObject(ctx, "bucket", "dir/hello.txt", bytes.NewReader(content), int64(len(content)),
+		minio.PutObjectOptions{ContentType: "text/plain", UserMetadata: map[string]string{"owner": "tests"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, info.ETag)
+
+	obj, err := mc.GetObject(ctx, "bucket", "dir/hello.txt", minio.GetObjectOptions{})
+	require.NoError(t, err)
+	data, err := io.ReadAll(obj)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	stat, err := mc.StatObject(ctx, "bucket", "dir/hello.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), stat.Size)
+	assert.Equal(t, "text/plain", stat.ContentType)
+	assert.Equal(t, "tests", stat.UserMetadata["Owner"])
+	assert.Equal(t, info.ETag, stat.ETag)
+
+	ranged := minio.GetObjectOptions{}
+	require.NoError(t, ranged.SetRange(6, 10))
+	obj, err = mc.GetObject(ctx, "bucket", "dir/hello.txt", ranged)
+	require.NoError(t, err)
+	data, err = io.ReadAll(obj)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	require.NoError(t, mc.RemoveObject(ctx, "bucket", "dir/hello.txt", minio.RemoveObjectOptions{}))
+	_, err = mc.StatObject(ctx, "bucket", "dir/hello.txt", minio.StatObjectOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+
+	// deleting a missing object succeeds
+	assert.NoError(t, mc.RemoveObject(ctx, "bucket", "dir/hello.txt", minio.RemoveObjectOptions{}))
+}
+
+func TestS3Server_ListObjects(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _ := startS3Server(t, "bucket")
+	mc, _ := minioFor(t, client, "bucket", "account")
+
+	keys := []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt"}
+	for _, key := range keys {
+		_, err := mc.PutObject(ctx, "bucket", key, strings.NewReader(key), int64(len(key)), minio.PutObjectOptions{})
+		require.NoError(t, err)
+	}
+
+	list := func(opts minio.ListObjectsOptions) []string {
+		var out []string
+		for o := range mc.ListObjects(ctx, "bucket", opts) {
+			require.NoError(t, o.Err)
+			out = append(out, o.Key)
+		}
+		return out
+	}
+
+	tests := map[string]struct {
+		opts     minio.ListObjectsOptions
+		expected []string
+	}{
+		"recursive": {
+			opts:     minio.ListObjectsOptions{Recursive: true},
+			expected: keys,
+		},
+		"top level": {
+			// within a page, objects are listed before common prefixes
+			opts:     minio.ListObjectsOptions{},
+			expected: []string{"a.txt", "e.txt", "dir/"},
+		},
+		"prefix": {
+			opts:     minio.ListObjectsOptions{Prefix: "dir/"},
+			expected: []string{"dir/b.txt", "dir/c.txt", "dir/sub/"},
+		},
+		"paginated": {
+			opts:     minio.ListObjectsOptions{Recursive: true, MaxKeys: 2},
+			expected: keys,
+		},
+		"paginated with common prefixes": {
+			opts:     minio.ListObjectsOptions{MaxKeys: 1},
+			expected: []string{"a.txt", "dir/", "e.txt"},
+		},
+		"v1": {
+			opts:     minio.ListObjectsOptions{UseV1: true, MaxKeys: 2},
+			expected: []string{"a.txt", "dir/", "e.txt"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, list(tc.opts))
+		})
+	}
+}
+
+func TestS3Server_Authentication(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, srv := startS3Server(t, "bucket", "other")
+	mc, creds := minioFor(t, client, "bucket", "account")
+	_, err := mc.PutObject(ctx, "bucket", "key", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		client       *minio.Client
+		bucket       string
+		expectedCode string
+	}{
+		"wrong secret": {
+			client:       newMinio(t, srv.URL, creds["accessKeyId"], "wrong"),
+			bucket:       "bucket",
+			expectedCode: "SignatureDoesNotMatch",
+		},
+		"unknown key": {
+			client:       newMinio(t, srv.URL, "unknown", creds["accessSecretKey"]),
+			bucket:       "bucket",
+			expectedCode: "InvalidAccessKeyId",
+		},
+		"other bucket": {
+			client:       mc,
+			bucket:       "other",
+			expectedCode: "AccessDenied",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tc.client.StatObject(ctx, tc.bucket, "key", minio.StatObjectOptions{})
+			assert.Error(t, err)
+			_, err = tc.client.PutObject(ctx, tc.bucket, "key", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+			assert.Equal(t, tc.expectedCode, minio.ToErrorResponse(err).Code)
+		})
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := http.Get(srv.URL + "/bucket/key")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Contains(t, string(body), "<Code>AccessDenied</Code>")
+	})
+}
+
+func TestS3Server_RevokedAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _ := startS3Server(t, "bucket")
+	mc, _ := minioFor(t, client, "bucket", "account")
+
+	exists, err := mc.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "account"))
+
+	_, err = mc.PutObject(ctx, "bucket", "key", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	assert.Equal(t, "InvalidAccessKeyId", minio.ToErrorResponse(err).Code)
+}
+
+func TestS3Server_DeletedBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _ := startS3Server(t, "bucket")
+	mc, _ := minioFor(t, client, "bucket", "account")
+
+	_, err := mc.PutObject(ctx, "bucket", "key", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	require.NoError(t, client.DeleteBucket(ctx, "bucket"))
+
+	exists, err := mc.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// objects do not come back with a new bucket of the same name
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+	_, err = mc.StatObject(ctx, "bucket", "key", minio.StatObjectOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+}
+
+func TestS3Server_Quota(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, _ := startS3Server(t)
+	require.NoError(t, client.CreateBucket(ctx, "bucket", map[string]string{"quota": "1Ki"}))
+	mc, _ := minioFor(t, client, "bucket", "account")
+
+	put := func(key string, size int) error {
+		_, err := mc.PutObject(ctx, "bucket", key, bytes.NewReader(make([]byte, size)), int64(size),
+			minio.PutObjectOptions{})
+		return err
+	}
+
+	require.NoError(t, put("a", 512))
+	require.NoError(t, put("b", 512))
+
+	err := put("c", 1)
+	assert.Equal(t, "XMinioAdminBucketQuotaExceeded", minio.ToErrorResponse(err).Code)
+	_, err = mc.StatObject(ctx, "bucket", "c", minio.StatObjectOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+
+	// replacing an object only counts its new size
+	require.NoError(t, put("b", 256))
+	require.NoError(t, put("c", 256))
+
+	// removing objects frees space
+	require.NoError(t, mc.RemoveObject(ctx, "bucket", "a", minio.RemoveObjectOptions{}))
+	require.NoError(t, put("d", 512))
+}
+
+func TestClient_HandlerUnsupportedPlatform(t *testing.T) {
+	t.Parallel()
+
+	for _, platform := range []string{"gcs"} {
+		_, err := New(platform).Handler("http://localhost")
+		assert.ErrorContains(t, err, fmt.Sprintf("platform %q", platform))
+	}
+}
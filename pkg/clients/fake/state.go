@@ -0,0 +1,106 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/fsutil"
+)
+
+// state is the content of the fake storage, persisted as JSON when a state file is configured.
+type state struct {
+	Platform   string             `json:"platform"`
+	AccountKey []byte             `json:"accountKey,omitempty"` // Key signing the SAS tokens of the azure platform.
+	Buckets    map[string]*Bucket `json:"buckets"`
+	Accesses   map[string]*Access `json:"accesses"` // accessKey(bucket, account) -> access
+}
+
+func newState(platform string) *state {
+	s := &state{
+		Platform: platform,
+		Buckets:  map[string]*Bucket{},
+		Accesses: map[string]*Access{},
+	}
+
+	if platform == "azure" {
+		s.AccountKey = make([]byte, 32)
+		_, _ = rand.Read(s.AccountKey) // never fails since Go 1.24
+	}
+
+	return s
+}
+
+// accessKey returns the key of the access of the account to the bucket.
+func accessKey(bucket, account string) string {
+	return bucket + "/" + account
+}
+
+// clone returns a deep copy of the state.
+func (s *state) clone() *state {
+	out := &state{
+		Platform:   s.Platform,
+		AccountKey: s.AccountKey,
+		Buckets:    make(map[string]*Bucket, len(s.Buckets)),
+		Accesses:   make(map[string]*Access, len(s.Accesses)),
+	}
+	for name, b := range s.Buckets {
+		out.Buckets[name] = b.clone()
+	}
+	for key, a := range s.Accesses {
+		out.Accesses[key] = a.clone()
+	}
+	return out
+}
+
+// readState loads the state file. A missing file yields an empty state.
+func readState(path, platform string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newState(platform), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state: %w", err)
+	}
+
+	s := newState(platform)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("unable to decode state %s: %w", path, err)
+	}
+	if s.Platform != platform {
+		return nil, fmt.Errorf("state %s belongs to platform %q, not %q", path, s.Platform, platform)
+	}
+
+	return s, nil
+}
+
+// writeState atomically replaces the state file, so that a crash leaves either the old or the new state.
+func writeState(path string, s *state) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode state: %w", err)
+	}
+
+	if err := fsutil.WriteFile(path, data); err != nil {
+		return fmt.Errorf("unable to write state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_PersistsState(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	client, err := Open("s3", path)
+	require.NoError(t, err)
+	require.NoError(t, client.CreateBucket(ctx, "kept", map[string]string{"param1": "value1"}))
+	require.NoError(t, client.CreateBucket(ctx, "deleted", nil))
+	require.NoError(t, client.DeleteBucket(ctx, "deleted"))
+	user, err := client.CreateBucketAccess(ctx, "kept", "access")
+	require.NoError(t, err)
+
+	// a restarted driver sees the same buckets and accesses
+	restarted, err := Open("s3", path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Bucket{
+		"kept": {Parameters: map[string]string{"param1": "value1"}},
+	}, restarted.Buckets())
+	assert.Equal(t, []Access{{
+		Bucket:      "kept",
+		Account:     "access",
+		Credentials: user.Credentials(),
+	}}, restarted.Accesses())
+
+	equal, err := restarted.IsBucketEqual(ctx, "kept", map[string]string{"param1": "value1"})
+	assert.NoError(t, err)
+	assert.True(t, equal)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		content       string
+		platform      string
+		expectedError string
+	}{
+		"missing file": {
+			platform: "s3",
+		},
+		"empty state": {
+			content:  `{"platform":"azure","buckets":{},"accesses":{}}`,
+			platform: "azure",
+		},
+		"corrupt file": {
+			content:       `{"platform":"s3","buckets":`,
+			platform:      "s3",
+			expectedError: "unable to decode state",
+		},
+		"different platform": {
+			content:       `{"platform":"azure"}`,
+			platform:      "s3",
+			expectedError: `belongs to platform "azure", not "s3"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tc.content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+			}
+
+			client, err := Open(tc.platform, path)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, client.Buckets())
+			assert.FileExists(t, path)
+		})
+	}
+}
+
+func TestOpen_InMemory(t *testing.T) {
+	t.Parallel()
+
+	client, err := Open("gcs", "")
+	require.NoError(t, err)
+	assert.NoError(t, client.CreateBucket(context.Background(), "bucket", nil))
+	assert.Contains(t, client.Buckets(), "bucket")
+}
+
+func TestClient_FailedWriteKeepsState(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "state")
+	require.NoError(t, os.Mkdir(dir, 0o700))
+
+	client, err := Open("s3", filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+
+	// removing the directory makes every following write fail
+	require.NoError(t, os.RemoveAll(dir))
+
+	assert.Error(t, client.CreateBucket(ctx, "other", nil))
+	assert.Error(t, client.DeleteBucket(ctx, "bucket"))
+	_, err = client.CreateBucketAccess(ctx, "bucket", "access")
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]Bucket{"bucket": {}}, client.Buckets())
+	assert.Empty(t, client.Accesses())
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// storageScope is the OAuth2 scope requested for the driver's access token.
+	storageScope = "https://www.googleapis.com/auth/devstorage.full_control"
+
+	// defaultTokenURI is used when the service account key does not specify one.
+	defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+	// tokenLifetime is the requested lifetime of the signed JWT assertion.
+	tokenLifetime = time.Hour
+
+	// tokenExpiryDelta is how long before its expiry a cached token is refreshed.
+	tokenExpiryDelta = time.Minute
+)
+
+// ServiceAccountKey is the JSON key of a Google Cloud service account.
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	ClientID     string `json:"client_id,omitempty"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// ParseServiceAccountKey decodes a service account JSON key.
+func ParseServiceAccountKey(data []byte) (*ServiceAccountKey, error) {
+	key := &ServiceAccountKey{}
+	if err := json.Unmarshal(data, key); err != nil {
+		return nil, fmt.Errorf("unable to decode service account key: %w", err)
+	}
+
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("unsupported credentials type: %q", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, errors.New("service account key is missing client_email or private_key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = defaultTokenURI
+	}
+
+	return key, nil
+}
+
+// tokenSource exchanges signed JWT assertions for OAuth2 access tokens and caches them.
+type tokenSource struct {
+	key        *ServiceAccountKey
+	privateKey *rsa.PrivateKey
+	http       *http.Client
+	now        func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newTokenSource(key *ServiceAccountKey, client *http.Client) (*tokenSource, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %w", err)
+	}
+
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return &tokenSource{
+		key:        key,
+		privateKey: privateKey,
+		http:       client,
+		now:        time.Now,
+	}, nil
+}
+
+// Token returns a valid access token, fetching a new one when the cached token is about to expire.
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && ts.now().Add(tokenExpiryDelta).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	assertion, err := ts.assertion()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("unable to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // best effort call
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("unable to decode token response: %w", err)
+	}
+
+	ts.token = out.AccessToken
+	ts.expiry = ts.now().Add(time.Duration(out.ExpiresIn) * time.Second)
+
+	return ts.token, nil
+}
+
+// assertion builds an RS256 signed JWT for the service account.
+func (ts *tokenSource) assertion() (string, error) {
+	now := ts.now()
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": ts.key.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iss":   ts.key.ClientEmail,
+		"scope": storageScope,
+		"aud":   ts.key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ts.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign token assertion: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
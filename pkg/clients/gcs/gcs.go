@@ -0,0 +1,312 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcs provides a Google Cloud Storage client implementation.
+// It talks to the GCS JSON API directly, authenticating with a service account key,
+// which makes it usable against both Google Cloud and local emulators such as fake-gcs-server.
+// Bucket accesses are not supported, as they require a service account per access and this client
+// does not manage service accounts. The driver's own key is never handed out.
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+const (
+	locationKey     = "location"
+	storageClassKey = "storageClass"
+
+	// defaultEndpoint is the public GCS JSON API endpoint.
+	defaultEndpoint = "https://storage.googleapis.com"
+)
+
+// schema is the set of BucketClass parameters understood by CreateBucket.
+var schema = clients.Schema{
+	{Name: locationKey, Type: clients.String, Default: "US"},
+	{Name: storageClassKey, Type: clients.String, Default: "STANDARD", Mutable: true},
+}
+
+// Client represents a Google Cloud Storage client instance.
+type Client struct {
+	endpoint  string       // Base URL of the JSON API, without the /storage/v1 suffix.
+	projectID string       // Project buckets are created in.
+	tokens    *tokenSource // Token source, nil when talking to an unauthenticated emulator.
+	http      *http.Client
+}
+
+// Verify that Client implements the clients.Client interface.
+var _ clients.Client = (*Client)(nil)
+
+// APIError is an error response returned by the GCS JSON API.
+type APIError struct {
+	Code    int    `json:"code"`    // HTTP status code of the response.
+	Message string `json:"message"` // Human-readable description of the error.
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gcs: %s (status %d)", e.Message, e.Code)
+}
+
+// Unwrap returns the error of the clients package matching the status of the error, if any.
+// Conflicts depend on the request and are mapped by the caller.
+func (e *APIError) Unwrap() error {
+	switch e.Code {
+	case http.StatusNotFound:
+		return clients.ErrBucketNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return clients.ErrPermissionDenied
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return clients.ErrThrottled
+	default:
+		return nil
+	}
+}
+
+// New creates a new GCS Client instance.
+// When serviceAccountKey is empty, requests are sent unauthenticated, which is only useful for emulators.
+// When projectID is empty, the project of the service account key is used.
+func New(endpoint, projectID string, serviceAccountKey []byte) (*Client, error) {
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	c := &Client{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		projectID: projectID,
+		http:      http.DefaultClient,
+	}
+
+	if len(serviceAccountKey) > 0 {
+		key, err := ParseServiceAccountKey(serviceAccountKey)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tokens, err = newTokenSource(key, c.http)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.projectID == "" {
+			c.projectID = key.ProjectID
+		}
+	}
+
+	if c.projectID == "" {
+		return nil, errors.New("project ID is required")
+	}
+
+	return c, nil
+}
+
+// bucketResource is the subset of the bucket resource used by the client.
+type bucketResource struct {
+	Name         string `json:"name"`
+	Location     string `json:"location,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// do sends a request to the JSON API and decodes the response into out, when out is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("unable to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	u := c.endpoint + "/storage/v1" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tokens != nil {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // best effort call
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errResp struct {
+			Error APIError `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body) //nolint:errcheck // the status code is reported regardless
+		if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error.Message == "" {
+			errResp.Error.Message = strings.TrimSpace(string(data))
+		}
+		errResp.Error.Code = resp.StatusCode
+		return &errResp.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return nil
+}
+
+func isNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func hasStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+func (c *Client) getBucket(ctx context.Context, bucket string) (*bucketResource, error) {
+	out := &bucketResource{}
+	if err := c.do(ctx, http.MethodGet, "/b/"+url.PathEscape(bucket), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BucketExists checks if a bucket exists in the project.
+func (c *Client) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	if _, err := c.getBucket(ctx, bucket); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsBucketEqual checks if the existing bucket has the expected location and storage class.
+// Parameters rejected by the schema are treated as a mismatch.
+// It fails with clients.ErrBucketAlreadyExists if the location differs, as it cannot be changed on an existing bucket.
+func (c *Client) IsBucketEqual(ctx context.Context, bucket string, params map[string]string) (bool, error) {
+	if err := schema.Validate(params); err != nil {
+		return false, nil
+	}
+
+	b, err := c.getBucket(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+
+	if err := schema.CheckImmutable(params, map[string]string{
+		locationKey:     b.Location,
+		storageClassKey: b.StorageClass,
+	}); err != nil {
+		return false, err
+	}
+	if class := params[storageClassKey]; class != "" && !strings.EqualFold(class, b.StorageClass) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// CreateBucket creates a new bucket in the project.
+// The optional location and storageClass parameters are passed to the bucket resource.
+// It fails with clients.ErrInvalidParameters if the parameters are not supported,
+// and with clients.ErrBucketAlreadyExists if the name is already taken, by this or another project.
+func (c *Client) CreateBucket(ctx context.Context, bucket string, params map[string]string) error {
+	if err := schema.Validate(params); err != nil {
+		return err
+	}
+
+	err := c.do(ctx, http.MethodPost, "/b", url.Values{"project": {c.projectID}}, &bucketResource{
+		Name:         bucket,
+		Location:     params[locationKey],
+		StorageClass: params[storageClassKey],
+	}, nil)
+	if hasStatus(err, http.StatusConflict) {
+		return fmt.Errorf("%w: %w", clients.ErrBucketAlreadyExists, err)
+	}
+	return err
+}
+
+// DeleteBucket deletes a bucket from the project.
+// It fails with clients.ErrBucketNotEmpty if the bucket still holds objects,
+// and with clients.ErrBucketNotFound if the bucket does not exist.
+func (c *Client) DeleteBucket(ctx context.Context, bucket string) error {
+	err := c.do(ctx, http.MethodDelete, "/b/"+url.PathEscape(bucket), nil, nil, nil)
+	if hasStatus(err, http.StatusConflict) {
+		return fmt.Errorf("%w: %w", clients.ErrBucketNotEmpty, err)
+	}
+	return err
+}
+
+// CreateBucketAccess fails with clients.ErrNotSupported. Granting an access limited to the bucket
+// requires creating a service account for it, which this client does not do.
+func (c *Client) CreateBucketAccess(_ context.Context, bucket, userID string) (clients.User, error) {
+	return nil, fmt.Errorf("%w: unable to grant %s access to bucket %s: per-access service accounts are not managed",
+		clients.ErrNotSupported, userID, bucket)
+}
+
+// DeleteBucketAccess succeeds without doing anything, as CreateBucketAccess never grants accesses.
+func (c *Client) DeleteBucketAccess(_ context.Context, _, _ string) error {
+	return nil
+}
+
+// ParameterSchema returns the BucketClass parameters supported by CreateBucket.
+func (c *Client) ParameterSchema() clients.Schema {
+	return schema
+}
+
+// NameRules returns the naming rules of GCS buckets.
+func (c *Client) NameRules() clients.NameRules {
+	return clients.GCSNameRules
+}
+
+// ProtocolInfo returns detailed information about protocol supported by the storage backend.
+// Only the project is reported, as the service account and key of the driver are never handed out.
+func (c *Client) ProtocolInfo() *cosi.Protocol {
+	return &cosi.Protocol{
+		Type: &cosi.Protocol_Gcs{
+			Gcs: &cosi.GCS{
+				ProjectId: c.projectID,
+			},
+		},
+	}
+}
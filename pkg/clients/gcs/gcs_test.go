@@ -0,0 +1,286 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+// fakeGCS is an httptest stand-in for the fake-gcs-server bucket API and the OAuth2 token endpoint.
+type fakeGCS struct {
+	mu      sync.Mutex
+	buckets map[string]bucketResource
+	token   string // Expected bearer token, empty to accept unauthenticated requests.
+	issued  int    // Number of tokens issued by the token endpoint.
+}
+
+func newFakeGCS(t *testing.T) (*fakeGCS, *httptest.Server) {
+	f := &fakeGCS{buckets: map[string]bucketResource{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, code, message)
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if err := r.ParseForm(); err != nil || strings.Count(r.PostForm.Get("assertion"), ".") != 2 {
+			writeError(w, http.StatusBadRequest, "invalid assertion")
+			return
+		}
+		f.issued++
+		fmt.Fprintf(w, `{"access_token":%q,"expires_in":3600,"token_type":"Bearer"}`, f.token)
+		return
+	}
+
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/storage/v1/b":
+		if r.URL.Query().Get("project") != "test-project" {
+			writeError(w, http.StatusBadRequest, "invalid project")
+			return
+		}
+		b := bucketResource{}
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := f.buckets[b.Name]; ok {
+			writeError(w, http.StatusConflict, "bucket already exists")
+			return
+		}
+		if b.Location == "" {
+			b.Location = "US"
+		}
+		if b.StorageClass == "" {
+			b.StorageClass = "STANDARD"
+		}
+		f.buckets[b.Name] = b
+		_ = json.NewEncoder(w).Encode(b)
+
+	case r.Method == http.MethodGet:
+		b, ok := f.buckets[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(b)
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.buckets[name]; !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		delete(f.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func testServiceAccountKey(t *testing.T, tokenURI string) []byte {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(ServiceAccountKey{
+		Type:         "service_account",
+		ProjectID:    "test-project",
+		PrivateKeyID: "key-id",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientEmail:  "driver@test-project.iam.gserviceaccount.com",
+		TokenURI:     tokenURI,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		projectID   string
+		key         []byte
+		expectedErr string
+	}{
+		"emulator": {
+			projectID: "test-project",
+		},
+		"missing project": {
+			expectedErr: "project ID is required",
+		},
+		"invalid key": {
+			key:         []byte(`{"type":"authorized_user"}`),
+			expectedErr: `unsupported credentials type: "authorized_user"`,
+		},
+		"malformed key": {
+			key:         []byte(`{`),
+			expectedErr: "unable to decode service account key",
+		},
+		"non PEM key": {
+			key:         []byte(`{"type":"service_account","client_email":"a@b","private_key":"key"}`),
+			expectedErr: "private key is not PEM encoded",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New("", tc.projectID, tc.key)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClient_Buckets(t *testing.T) {
+	t.Parallel()
+
+	_, srv := newFakeGCS(t)
+	client, err := New(srv.URL, "test-project", nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	exists, err := client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	err = client.CreateBucket(ctx, "bucket", map[string]string{"location": "EU", "storageClass": "NEARLINE"})
+	require.NoError(t, err)
+
+	exists, err = client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	err = client.CreateBucket(ctx, "bucket", nil)
+	assert.ErrorContains(t, err, "bucket already exists")
+	assert.ErrorIs(t, err, clients.ErrBucketAlreadyExists)
+
+	for name, tc := range map[string]struct {
+		params   map[string]string
+		expected bool
+	}{
+		"matching":          {params: map[string]string{"location": "eu", "storageClass": "nearline"}, expected: true},
+		"no parameters":     {params: nil, expected: true},
+		"other class":       {params: map[string]string{"storageClass": "STANDARD"}, expected: false},
+		"unknown parameter": {params: map[string]string{"versioning": "true"}, expected: false},
+	} {
+		equal, err := client.IsBucketEqual(ctx, "bucket", tc.params)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, equal, name)
+	}
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", map[string]string{"location": "US"})
+	assert.ErrorIs(t, err, clients.ErrBucketAlreadyExists, "the location is immutable")
+	assert.False(t, equal)
+
+	require.NoError(t, client.DeleteBucket(ctx, "bucket"))
+
+	exists, err = client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.ErrorIs(t, client.DeleteBucket(ctx, "bucket"), clients.ErrBucketNotFound)
+}
+
+func TestClient_CreateBucket_UnsupportedParameter(t *testing.T) {
+	t.Parallel()
+
+	_, srv := newFakeGCS(t)
+	client, err := New(srv.URL, "test-project", nil)
+	require.NoError(t, err)
+
+	err = client.CreateBucket(context.Background(), "bucket", map[string]string{"region": "x"})
+	assert.ErrorContains(t, err, `unknown parameter "region"`)
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_Authenticated(t *testing.T) {
+	t.Parallel()
+
+	f, srv := newFakeGCS(t)
+	f.token = "access-token"
+	key := testServiceAccountKey(t, srv.URL+"/token")
+
+	client, err := New(srv.URL, "", key)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+	exists, err := client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	f.mu.Lock()
+	assert.Equal(t, 1, f.issued, "token must be cached")
+	f.mu.Unlock()
+
+	_, err = client.CreateBucketAccess(ctx, "bucket", "user")
+	assert.ErrorIs(t, err, clients.ErrNotSupported, "the driver's key must not be handed out")
+	require.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "user"))
+
+	protocol := client.ProtocolInfo()
+	assert.IsType(t, &cosi.Protocol_Gcs{}, protocol.GetType())
+	assert.Equal(t, "test-project", protocol.GetGcs().GetProjectId())
+	assert.Empty(t, protocol.GetGcs().GetServiceAccount())
+	assert.Empty(t, protocol.GetGcs().GetPrivateKeyName())
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	t.Parallel()
+
+	f, srv := newFakeGCS(t)
+	f.token = "access-token"
+
+	client, err := New(srv.URL, "test-project", nil)
+	require.NoError(t, err)
+
+	_, err = client.BucketExists(context.Background(), "bucket")
+	assert.ErrorContains(t, err, "status 401")
+	assert.ErrorIs(t, err, clients.ErrPermissionDenied)
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsutil provides filesystem helpers shared by the clients persisting their state to files.
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces the file, so that a crash leaves either the old or the new content.
+// The data is written to a temporary file in the same directory, synced and renamed over the file.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck // best effort cleanup, fails after a successful rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close() //nolint:errcheck // the write error is reported
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close() //nolint:errcheck // the sync error is reported
+		return fmt.Errorf("unable to sync: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace: %w", err)
+	}
+
+	// sync the directory, so the rename itself is durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()  //nolint:errcheck // best effort call
+		d.Close() //nolint:errcheck // best effort call
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sigv4 implements the subset of AWS Signature Version 4 needed by the
+// clients to talk to AWS-compatible endpoints that are not covered by the MinIO SDK.
+package sigv4
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the signing algorithm identifier used in the Authorization header.
+	Algorithm = "AWS4-HMAC-SHA256"
+
+	// TimeFormat is the format of the X-Amz-Date header.
+	TimeFormat = "20060102T150405Z"
+
+	// DateFormat is the format of the date part of the credential scope.
+	DateFormat = "20060102"
+
+	// UnsignedPayload is the payload hash value used when the body is not signed.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// StreamingPayload is the payload hash value used when the body is sent as signed aws-chunked chunks.
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// chunkAlgorithm is the algorithm identifier of the string to sign of a chunk.
+	chunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+// Credentials holds the key pair used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// Sign signs the request in place for the given region and service.
+// The body must be the exact payload that is going to be sent with the request.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	payloadHash := HashHex(body)
+
+	req.Header.Set("X-Amz-Date", now.Format(TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	for k := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(k))
+	}
+	sort.Strings(signedHeaders)
+
+	scope := Scope(now, region, service)
+	signature := Signature(req, signedHeaders, payloadHash, creds.SecretAccessKey, region, service, now)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		Algorithm, creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+// Signature calculates the request signature over the given (lowercase, sorted) signed headers.
+func Signature(
+	req *http.Request,
+	signedHeaders []string,
+	payloadHash, secret, region, service string,
+	t time.Time,
+) string {
+	stringToSign := strings.Join([]string{
+		Algorithm,
+		t.UTC().Format(TimeFormat),
+		Scope(t, region, service),
+		HashHex([]byte(canonicalRequest(req, signedHeaders, payloadHash))),
+	}, "\n")
+
+	return hex.EncodeToString(hmacSHA256(SigningKey(secret, region, service, t), stringToSign))
+}
+
+// SigningKey derives the key signatures are calculated with for the given date, region and service.
+func SigningKey(secret, region, service string, t time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), t.UTC().Format(DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// ChunkSignature calculates the signature of a chunk of a streaming payload.
+// The first chunk is chained to the seed signature of the request, every other chunk to its predecessor.
+func ChunkSignature(key []byte, t time.Time, scope, previous string, chunk []byte) string {
+	stringToSign := strings.Join([]string{
+		chunkAlgorithm,
+		t.UTC().Format(TimeFormat),
+		scope,
+		previous,
+		HashHex(nil),
+		HashHex(chunk),
+	}, "\n")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// ReadChunked decodes a streaming payload in the aws-chunked encoding and verifies the signature of each chunk.
+// The chain of signatures starts with the seed signature of the request.
+func ReadChunked(r io.Reader, key []byte, t time.Time, scope, seed string) ([]byte, error) {
+	var (
+		br       = bufio.NewReader(r)
+		out      bytes.Buffer
+		previous = seed
+	)
+
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unable to read chunk header: %w", err)
+		}
+
+		size, params, _ := strings.Cut(strings.TrimSuffix(header, "\r\n"), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malformed chunk size: %q", size)
+		}
+		signature, ok := strings.CutPrefix(params, "chunk-signature=")
+		if !ok {
+			return nil, fmt.Errorf("chunk is missing its signature: %q", header)
+		}
+
+		chunk := make([]byte, n+2) // data followed by CRLF
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, fmt.Errorf("unable to read chunk: %w", err)
+		}
+		chunk = chunk[:n]
+
+		expected := ChunkSignature(key, t, scope, previous, chunk)
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return nil, errors.New("chunk signature does not match")
+		}
+		previous = signature
+
+		if n == 0 {
+			return out.Bytes(), nil
+		}
+		out.Write(chunk)
+	}
+}
+
+// Authorization is a parsed SigV4 Authorization header.
+type Authorization struct {
+	AccessKeyID   string
+	Date          string // Date of the credential scope, in DateFormat.
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+}
+
+// Scope returns the credential scope of the authorization.
+func (a *Authorization) Scope() string {
+	return strings.Join([]string{a.Date, a.Region, a.Service, "aws4_request"}, "/")
+}
+
+// ParseAuthorization parses the value of a SigV4 Authorization header.
+func ParseAuthorization(header string) (*Authorization, error) {
+	algorithm, rest, _ := strings.Cut(header, " ")
+	if algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported authorization algorithm: %q", algorithm)
+	}
+
+	auth := &Authorization{}
+	for _, field := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case "Credential":
+			parts := strings.Split(v, "/")
+			if len(parts) != 5 || parts[4] != "aws4_request" {
+				return nil, fmt.Errorf("malformed credential: %q", v)
+			}
+			auth.AccessKeyID, auth.Date, auth.Region, auth.Service = parts[0], parts[1], parts[2], parts[3]
+		case "SignedHeaders":
+			auth.SignedHeaders = strings.Split(v, ";")
+		case "Signature":
+			auth.Signature = v
+		}
+	}
+
+	if auth.AccessKeyID == "" || len(auth.SignedHeaders) == 0 || auth.Signature == "" {
+		return nil, errors.New("authorization header is missing the credential, signed headers or signature")
+	}
+
+	return auth, nil
+}
+
+// Scope returns the credential scope for the given time, region and service.
+func Scope(t time.Time, region, service string) string {
+	return strings.Join([]string{t.UTC().Format(DateFormat), region, service, "aws4_request"}, "/")
+}
+
+// HashHex returns the hex encoded SHA256 of data.
+func HashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	headers := make([]string, 0, len(signedHeaders))
+	for _, h := range signedHeaders {
+		var value string
+		switch {
+		case h == "host":
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		case h == "content-length" && req.Header.Get(h) == "":
+			// servers move the header into the request's ContentLength
+			value = strconv.FormatInt(req.ContentLength, 10)
+		default:
+			value = strings.Join(req.Header.Values(h), ",")
+		}
+		headers = append(headers, h+":"+strings.Join(strings.Fields(value), " "))
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes s as required by SigV4 (RFC 3986 unreserved characters are kept).
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BucketClass parameters describing the lifecycle rules of a bucket.
+const (
+	ExpireAfterDaysKey                = "expireAfterDays"
+	NoncurrentExpireAfterDaysKey      = "noncurrentExpireAfterDays"
+	AbortIncompleteUploadAfterDaysKey = "abortIncompleteUploadAfterDays"
+	TransitionAfterDaysKey            = "transitionAfterDays"
+	TransitionStorageClassKey         = "transitionStorageClass"
+)
+
+// LifecycleSchema is the set of lifecycle parameters, for clients supporting lifecycle rules.
+var LifecycleSchema = Schema{
+	{Name: ExpireAfterDaysKey, Type: Int, Mutable: true},
+	{Name: NoncurrentExpireAfterDaysKey, Type: Int, Mutable: true},
+	{Name: AbortIncompleteUploadAfterDaysKey, Type: Int, Mutable: true},
+	{Name: TransitionAfterDaysKey, Type: Int, Mutable: true},
+	{Name: TransitionStorageClassKey, Type: String, Mutable: true},
+}
+
+// Lifecycle describes the lifecycle rules applied to all the objects of a bucket.
+// A zero number of days disables the corresponding rule.
+type Lifecycle struct {
+	// ExpireAfterDays is the number of days after their creation before objects expire.
+	ExpireAfterDays int `json:"expireAfterDays,omitempty"`
+	// NoncurrentExpireAfterDays is the number of days after they become noncurrent before object versions are removed.
+	NoncurrentExpireAfterDays int `json:"noncurrentExpireAfterDays,omitempty"`
+	// AbortIncompleteUploadAfterDays is the number of days after their initiation before incomplete
+	// multipart uploads are aborted.
+	AbortIncompleteUploadAfterDays int `json:"abortIncompleteUploadAfterDays,omitempty"`
+	// TransitionAfterDays is the number of days after their creation before objects move to TransitionStorageClass.
+	TransitionAfterDays int `json:"transitionAfterDays,omitempty"`
+	// TransitionStorageClass is the storage class objects move to, e.g. GLACIER, or a remote tier with MinIO.
+	TransitionStorageClass string `json:"transitionStorageClass,omitempty"`
+}
+
+// IsZero reports whether no lifecycle rule is set.
+func (l Lifecycle) IsZero() bool {
+	return l == Lifecycle{}
+}
+
+// ParseLifecycle converts the lifecycle parameters of a BucketClass into lifecycle rules.
+// Other parameters are ignored. The numbers of days must be positive, the transition storage class
+// and delay must be set together, and objects must not expire before they transition.
+func ParseLifecycle(params map[string]string) (Lifecycle, error) {
+	var l Lifecycle
+
+	for _, p := range []struct {
+		key  string
+		days *int
+	}{
+		{ExpireAfterDaysKey, &l.ExpireAfterDays},
+		{NoncurrentExpireAfterDaysKey, &l.NoncurrentExpireAfterDays},
+		{AbortIncompleteUploadAfterDaysKey, &l.AbortIncompleteUploadAfterDays},
+		{TransitionAfterDaysKey, &l.TransitionAfterDays},
+	} {
+		v := params[p.key]
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Lifecycle{}, fmt.Errorf("invalid %s value %q: must be a positive number of days", p.key, v)
+		}
+		*p.days = n
+	}
+
+	l.TransitionStorageClass = params[TransitionStorageClassKey]
+	if (l.TransitionStorageClass == "") != (l.TransitionAfterDays == 0) {
+		return Lifecycle{}, fmt.Errorf("%s and %s must be set together", TransitionStorageClassKey, TransitionAfterDaysKey)
+	}
+	if l.ExpireAfterDays > 0 && l.TransitionAfterDays >= l.ExpireAfterDays {
+		return Lifecycle{}, fmt.Errorf("%s must be greater than %s", ExpireAfterDaysKey, TransitionAfterDaysKey)
+	}
+
+	return l, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLifecycle(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params      map[string]string
+		expected    Lifecycle
+		expectedErr string
+	}{
+		"no parameters": {},
+		"other parameters": {
+			params: map[string]string{"region": "eu-west-1"},
+		},
+		"all rules": {
+			params: map[string]string{
+				"expireAfterDays":                "365",
+				"noncurrentExpireAfterDays":      "30",
+				"abortIncompleteUploadAfterDays": "7",
+				"transitionAfterDays":            "90",
+				"transitionStorageClass":         "GLACIER",
+			},
+			expected: Lifecycle{
+				ExpireAfterDays:                365,
+				NoncurrentExpireAfterDays:      30,
+				AbortIncompleteUploadAfterDays: 7,
+				TransitionAfterDays:            90,
+				TransitionStorageClass:         "GLACIER",
+			},
+		},
+		"empty values": {
+			params: map[string]string{"expireAfterDays": "", "transitionStorageClass": ""},
+		},
+		"not a number": {
+			params:      map[string]string{"expireAfterDays": "30d"},
+			expectedErr: `invalid expireAfterDays value "30d": must be a positive number of days`,
+		},
+		"zero days": {
+			params:      map[string]string{"abortIncompleteUploadAfterDays": "0"},
+			expectedErr: `invalid abortIncompleteUploadAfterDays value "0"`,
+		},
+		"negative days": {
+			params:      map[string]string{"noncurrentExpireAfterDays": "-1"},
+			expectedErr: `invalid noncurrentExpireAfterDays value "-1"`,
+		},
+		"storage class without delay": {
+			params:      map[string]string{"transitionStorageClass": "GLACIER"},
+			expectedErr: "transitionStorageClass and transitionAfterDays must be set together",
+		},
+		"delay without storage class": {
+			params:      map[string]string{"transitionAfterDays": "30"},
+			expectedErr: "transitionStorageClass and transitionAfterDays must be set together",
+		},
+		"expiration before transition": {
+			params: map[string]string{
+				"expireAfterDays": "30", "transitionAfterDays": "60", "transitionStorageClass": "GLACIER",
+			},
+			expectedErr: "expireAfterDays must be greater than transitionAfterDays",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			l, err := ParseLifecycle(tc.params)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, l)
+			assert.Equal(t, tc.expected == Lifecycle{}, l.IsZero())
+		})
+	}
+}
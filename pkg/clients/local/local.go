@@ -0,0 +1,380 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package local provides a client storing buckets as directories of the local filesystem.
+// Each bucket is a directory under the root, holding the objects of the bucket as files.
+// The parameters and accesses of the buckets are persisted as JSON files under the .cosi
+// directory of the root, so buckets survive driver restarts and can be inspected with regular tools.
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/fsutil"
+)
+
+const (
+	// ForceDeleteKey is the bucket parameter allowing DeleteBucket to remove a bucket with its content.
+	ForceDeleteKey = "forceDelete"
+
+	// metadataDir is the directory of the root holding the parameters and accesses of the buckets.
+	metadataDir = ".cosi"
+
+	localRegion = "local"
+)
+
+// schema is the set of BucketClass parameters understood by the client.
+var schema = clients.Schema{
+	{Name: ForceDeleteKey, Type: clients.Bool, Default: "false"},
+}
+
+// Client stores buckets as directories under a root directory.
+// It is safe for concurrent use within a process.
+type Client struct {
+	mu   sync.Mutex
+	root string
+}
+
+// Verify that Client implements the clients.Client interface.
+var _ clients.Client = (*Client)(nil)
+
+// bucket is the metadata of a bucket persisted under the metadata directory.
+type bucket struct {
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// access is an access to a bucket persisted under the metadata directory.
+type access struct {
+	Credentials map[string]string `json:"credentials"` // Generated once, when the access is created.
+}
+
+// user implements the clients.User interface and represents an access to a local bucket.
+type user struct {
+	name        string
+	credentials map[string]string
+}
+
+// Verify that user implements the clients.User interface.
+var _ clients.User = (*user)(nil)
+
+// Name returns the name of the user.
+func (u *user) Name() string {
+	return u.name
+}
+
+// Credentials returns the access key pair of the user and the path of the bucket directory.
+func (u *user) Credentials() map[string]string {
+	return maps.Clone(u.credentials)
+}
+
+// Platform returns the name of the platform associated with the user.
+func (u *user) Platform() string {
+	return "s3"
+}
+
+// New creates a new local Client storing buckets under root, creating the directory if needed.
+func New(root string) (*Client, error) {
+	if root == "" {
+		return nil, errors.New("root directory is required")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root directory: %w", err)
+	}
+
+	c := &Client{root: root}
+	for _, dir := range []string{c.metadataPath("buckets"), c.metadataPath("accesses")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create root directory: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// BucketExists checks if the bucket directory exists.
+func (c *Client) BucketExists(_ context.Context, name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.exists(name)
+}
+
+// IsBucketEqual checks if the bucket was created with the given parameters.
+// A bucket directory created outside of the driver has no parameters.
+// It fails with clients.ErrBucketAlreadyExists if an immutable parameter differs.
+func (c *Client) IsBucketEqual(_ context.Context, name string, parameters map[string]string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if exists, err := c.exists(name); err != nil || !exists {
+		return false, err
+	}
+
+	var b bucket
+	if err := readJSON(c.bucketPath(name), &b); err != nil {
+		return false, err
+	}
+	if err := schema.CheckImmutable(parameters, b.Parameters); err != nil {
+		return false, err
+	}
+	return maps.Equal(b.Parameters, parameters), nil
+}
+
+// CreateBucket creates the bucket directory and persists the parameters of the bucket.
+// It fails with clients.ErrInvalidParameters if the ForceDeleteKey parameter is not a boolean.
+func (c *Client) CreateBucket(_ context.Context, name string, parameters map[string]string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if v, ok := parameters[ForceDeleteKey]; ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%w: invalid %s value: %w", clients.ErrInvalidParameters, ForceDeleteKey, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(c.root, name), 0o755); err != nil {
+		return fmt.Errorf("unable to create bucket %s: %w", name, err)
+	}
+
+	return writeJSON(c.bucketPath(name), bucket{Parameters: parameters})
+}
+
+// DeleteBucket deletes the bucket directory along with the metadata and accesses of the bucket.
+// It fails with clients.ErrBucketNotEmpty if the directory is not empty, unless the bucket was created
+// with the ForceDeleteKey parameter set to true. Deleting a bucket that does not exist succeeds.
+func (c *Client) DeleteBucket(_ context.Context, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir := filepath.Join(c.root, name)
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// the metadata may be left over from an interrupted deletion
+	case err != nil:
+		return fmt.Errorf("unable to read bucket %s: %w", name, err)
+	case len(entries) > 0:
+		var b bucket
+		if err := readJSON(c.bucketPath(name), &b); err != nil {
+			return err
+		}
+		if force, _ := strconv.ParseBool(b.Parameters[ForceDeleteKey]); !force {
+			return fmt.Errorf("%w: %s holds %d entries", clients.ErrBucketNotEmpty, name, len(entries))
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("unable to delete bucket %s: %w", name, err)
+	}
+	if err := os.RemoveAll(c.metadataPath("accesses", name)); err != nil {
+		return fmt.Errorf("unable to delete accesses of bucket %s: %w", name, err)
+	}
+	if err := os.Remove(c.bucketPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to delete metadata of bucket %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// CreateBucketAccess creates an access of the account to the bucket.
+// Credentials are generated once per bucket and account; granting an existing access again
+// returns the same credentials. It fails with clients.ErrBucketNotFound if the bucket does not exist.
+func (c *Client) CreateBucketAccess(_ context.Context, bucketName, name string) (clients.User, error) {
+	if err := validateName(bucketName); err != nil {
+		return nil, err
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exists, err := c.exists(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", clients.ErrBucketNotFound, bucketName)
+	}
+
+	path := c.accessPath(bucketName, name)
+
+	var a access
+	if err := readJSON(path, &a); err != nil {
+		return nil, err
+	}
+
+	if a.Credentials == nil {
+		a.Credentials = map[string]string{
+			"accessKeyId":     strings.ToUpper(genKey(10)),
+			"accessSecretKey": genKey(20),
+			"path":            filepath.Join(c.root, bucketName),
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create access: %w", err)
+		}
+		if err := writeJSON(path, a); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user{
+		name:        name,
+		credentials: a.Credentials,
+	}, nil
+}
+
+// DeleteBucketAccess deletes the access of the account to the bucket.
+// Deleting an access that does not exist succeeds.
+func (c *Client) DeleteBucketAccess(_ context.Context, bucketName, name string) error {
+	if err := validateName(bucketName); err != nil {
+		return err
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Remove(c.accessPath(bucketName, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to delete access: %w", err)
+	}
+
+	return nil
+}
+
+// ParameterSchema returns the BucketClass parameters supported by CreateBucket.
+// Other parameters are persisted as is, but are rejected by the driver.
+func (c *Client) ParameterSchema() clients.Schema {
+	return schema
+}
+
+// NameRules returns the naming rules of S3 buckets, as local buckets are served as S3 buckets.
+func (c *Client) NameRules() clients.NameRules {
+	return clients.S3NameRules
+}
+
+// ProtocolInfo returns the S3 protocol of the local buckets.
+func (c *Client) ProtocolInfo() *cosi.Protocol {
+	return &cosi.Protocol{
+		Type: &cosi.Protocol_S3{
+			S3: &cosi.S3{
+				Region:           localRegion,
+				SignatureVersion: cosi.S3SignatureVersion_S3V4,
+			},
+		},
+	}
+}
+
+func (c *Client) exists(name string) (bool, error) {
+	info, err := os.Stat(filepath.Join(c.root, name))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("unable to read bucket %s: %w", name, err)
+	default:
+		return info.IsDir(), nil
+	}
+}
+
+func (c *Client) metadataPath(elem ...string) string {
+	return filepath.Join(append([]string{c.root, metadataDir}, elem...)...)
+}
+
+func (c *Client) bucketPath(name string) string {
+	return c.metadataPath("buckets", name+".json")
+}
+
+func (c *Client) accessPath(bucketName, name string) string {
+	return c.metadataPath("accesses", bucketName, name+".json")
+}
+
+// validateName checks that the bucket or account name is usable as a single path element,
+// which does not clash with the metadata directory.
+func validateName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
+
+// readJSON decodes the file into v, leaving v unchanged if the file does not exist.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %w", path, err)
+	}
+
+	if err := fsutil.WriteFile(path, data); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// genKey returns n random bytes, hex encoded.
+func genKey(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never fails since Go 1.24
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+func newClient(t *testing.T) *Client {
+	client, err := New(t.TempDir())
+	require.NoError(t, err)
+	return client
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("")
+	assert.ErrorContains(t, err, "root directory is required")
+
+	root := filepath.Join(t.TempDir(), "nested", "root")
+	_, err = New(root)
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(root, ".cosi", "buckets"))
+}
+
+func TestClient_Buckets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t)
+	parameters := map[string]string{"param1": "value1"}
+
+	exists, err := client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", parameters))
+	assert.DirExists(t, filepath.Join(client.root, "bucket"))
+
+	exists, err = client.BucketExists(ctx, "bucket")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	equal, err := client.IsBucketEqual(ctx, "bucket", parameters)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	equal, err = client.IsBucketEqual(ctx, "bucket", map[string]string{"param1": "other"})
+	require.NoError(t, err)
+	assert.False(t, equal)
+
+	// a restarted driver sees the same buckets
+	restarted, err := New(client.root)
+	require.NoError(t, err)
+	equal, err = restarted.IsBucketEqual(ctx, "bucket", parameters)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	// directories created outside of the driver are buckets without parameters
+	require.NoError(t, os.Mkdir(filepath.Join(client.root, "manual"), 0o755))
+	equal, err = client.IsBucketEqual(ctx, "manual", nil)
+	require.NoError(t, err)
+	assert.True(t, equal)
+}
+
+func TestClient_DeleteBucket(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		parameters    map[string]string
+		objects       []string
+		expectedError error
+	}{
+		"empty bucket": {},
+		"non-empty bucket": {
+			objects:       []string{"object", "dir/object"},
+			expectedError: clients.ErrBucketNotEmpty,
+		},
+		"non-empty bucket with force delete": {
+			parameters: map[string]string{ForceDeleteKey: "true"},
+			objects:    []string{"object", "dir/object"},
+		},
+		"non-empty bucket with force delete disabled": {
+			parameters:    map[string]string{ForceDeleteKey: "false"},
+			objects:       []string{"object"},
+			expectedError: clients.ErrBucketNotEmpty,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			client := newClient(t)
+			require.NoError(t, client.CreateBucket(ctx, "bucket", tc.parameters))
+			_, err := client.CreateBucketAccess(ctx, "bucket", "account")
+			require.NoError(t, err)
+
+			for _, object := range tc.objects {
+				path := filepath.Join(client.root, "bucket", object)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+			}
+
+			err = client.DeleteBucket(ctx, "bucket")
+			exists, existsErr := client.BucketExists(ctx, "bucket")
+			require.NoError(t, existsErr)
+
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.True(t, exists)
+				return
+			}
+			require.NoError(t, err)
+			assert.False(t, exists)
+			assert.NoFileExists(t, client.bucketPath("bucket"))
+			assert.NoDirExists(t, client.metadataPath("accesses", "bucket"))
+
+			// deleting a bucket that does not exist succeeds
+			assert.NoError(t, client.DeleteBucket(ctx, "bucket"))
+		})
+	}
+}
+
+func TestClient_CreateBucket_InvalidForceDelete(t *testing.T) {
+	t.Parallel()
+
+	err := newClient(t).CreateBucket(context.Background(), "bucket", map[string]string{ForceDeleteKey: "maybe"})
+	assert.ErrorContains(t, err, "invalid forceDelete value")
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_BucketAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t)
+
+	_, err := client.CreateBucketAccess(ctx, "bucket", "account")
+	assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+
+	user, err := client.CreateBucketAccess(ctx, "bucket", "account")
+	require.NoError(t, err)
+	assert.Equal(t, "account", user.Name())
+	assert.Equal(t, "s3", user.Platform())
+	for _, key := range []string{"accessKeyId", "accessSecretKey"} {
+		assert.NotEmpty(t, user.Credentials()[key])
+	}
+	assert.Equal(t, filepath.Join(client.root, "bucket"), user.Credentials()["path"])
+
+	// granting the access again returns the same credentials
+	again, err := client.CreateBucketAccess(ctx, "bucket", "account")
+	require.NoError(t, err)
+	assert.Equal(t, user.Credentials(), again.Credentials())
+
+	other, err := client.CreateBucketAccess(ctx, "bucket", "other")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.Credentials()["accessKeyId"], other.Credentials()["accessKeyId"])
+
+	require.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "account"))
+	assert.NoFileExists(t, client.accessPath("bucket", "account"))
+	assert.FileExists(t, client.accessPath("bucket", "other"))
+
+	// revoking an access that does not exist succeeds
+	assert.NoError(t, client.DeleteBucketAccess(ctx, "bucket", "account"))
+
+	renewed, err := client.CreateBucketAccess(ctx, "bucket", "account")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.Credentials()["accessKeyId"], renewed.Credentials()["accessKeyId"])
+}
+
+func TestClient_InvalidNames(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t)
+
+	for _, name := range []string{"", ".cosi", "..", "a/b", `a\b`} {
+		_, err := client.BucketExists(ctx, name)
+		assert.ErrorContains(t, err, "invalid name", name)
+
+		assert.ErrorContains(t, client.CreateBucket(ctx, name, nil), "invalid name", name)
+		assert.ErrorContains(t, client.DeleteBucket(ctx, name), "invalid name", name)
+
+		_, err = client.CreateBucketAccess(ctx, "bucket", name)
+		assert.ErrorContains(t, err, "invalid name", name)
+	}
+}
+
+func TestClient_ProtocolInfo(t *testing.T) {
+	t.Parallel()
+
+	info := newClient(t).ProtocolInfo()
+	require.NotNil(t, info.GetS3())
+	assert.Equal(t, "local", info.GetS3().GetRegion())
+}
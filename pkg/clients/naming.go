@@ -0,0 +1,161 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NameRules describes the bucket names accepted by a backend.
+// Names are made of lowercase letters, digits and separators.
+type NameRules struct {
+	MinLength int // Minimum length of a name.
+	MaxLength int // Maximum length of a name.
+
+	// Separators are the characters allowed besides lowercase letters and digits,
+	// neither at either end of a name nor next to each other.
+	// The first one replaces the invalid characters of sanitized names.
+	Separators string
+
+	ReservedPrefixes   []string // Prefixes names must not start with.
+	ReservedSuffixes   []string // Suffixes names must not end with.
+	ReservedSubstrings []string // Substrings names must not contain.
+}
+
+var (
+	// S3NameRules are the naming rules of Amazon S3 general purpose buckets.
+	S3NameRules = NameRules{
+		MinLength:        3,
+		MaxLength:        63,
+		Separators:       "-.",
+		ReservedPrefixes: []string{"xn--", "sthree-", "amzn-s3-demo-"},
+		ReservedSuffixes: []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3"},
+	}
+
+	// AzureNameRules are the naming rules of Azure Blob Storage containers.
+	AzureNameRules = NameRules{
+		MinLength:  3,
+		MaxLength:  63,
+		Separators: "-",
+	}
+
+	// GCSNameRules are the naming rules of Google Cloud Storage buckets, without dotted names
+	// longer than 63 characters, which require domain verification.
+	GCSNameRules = NameRules{
+		MinLength:          3,
+		MaxLength:          63,
+		Separators:         "-_.",
+		ReservedPrefixes:   []string{"goog"},
+		ReservedSubstrings: []string{"google", "g00gle"},
+	}
+)
+
+// Sanitize lowercases the name, replaces its invalid characters with the first separator,
+// collapses consecutive separators and trims separators at both ends.
+// The result is not truncated and may still break the length or reserved word rules.
+func (r NameRules) Sanitize(name string) string {
+	replacement := '-'
+	if r.Separators != "" {
+		replacement = rune(r.Separators[0])
+	}
+
+	var b strings.Builder
+	separated := true // Drops leading separators.
+	for _, c := range strings.ToLower(name) {
+		if !isAlphanumeric(c) && !strings.ContainsRune(r.Separators, c) {
+			c = replacement
+		}
+		if !isAlphanumeric(c) {
+			if separated {
+				continue
+			}
+			separated = true
+		} else {
+			separated = false
+		}
+		b.WriteRune(c)
+	}
+
+	return r.trim(b.String())
+}
+
+// Truncate shortens the name to the maximum length, trimming separators left at its end.
+func (r NameRules) Truncate(name string) string {
+	if len(name) > r.MaxLength {
+		name = r.trim(name[:r.MaxLength])
+	}
+	return name
+}
+
+// Validate checks that the name follows the rules. The returned error wraps ErrInvalidBucketName.
+func (r NameRules) Validate(name string) error {
+	if reason := r.validate(name); reason != "" {
+		return fmt.Errorf("%w %q: %s", ErrInvalidBucketName, name, reason)
+	}
+	return nil
+}
+
+// validate returns the reason the name breaks the rules, or an empty string if it follows them.
+func (r NameRules) validate(name string) string {
+	if len(name) < r.MinLength || len(name) > r.MaxLength {
+		return fmt.Sprintf("must be between %d and %d characters long", r.MinLength, r.MaxLength)
+	}
+
+	for _, p := range r.ReservedPrefixes {
+		if strings.HasPrefix(name, p) {
+			return fmt.Sprintf("must not start with %q", p)
+		}
+	}
+	for _, s := range r.ReservedSuffixes {
+		if strings.HasSuffix(name, s) {
+			return fmt.Sprintf("must not end with %q", s)
+		}
+	}
+	for _, s := range r.ReservedSubstrings {
+		if strings.Contains(name, s) {
+			return fmt.Sprintf("must not contain %q", s)
+		}
+	}
+
+	prev := '-'
+	for i, c := range name {
+		switch {
+		case isAlphanumeric(c):
+		case !strings.ContainsRune(r.Separators, c):
+			return fmt.Sprintf("must only contain lowercase letters, digits and %q", r.Separators)
+		case i == 0 || i == len(name)-1:
+			return "must start and end with a letter or digit"
+		case !isAlphanumeric(prev):
+			return "must not contain consecutive separators"
+		}
+		prev = c
+	}
+
+	if net.ParseIP(name) != nil {
+		return "must not be formatted as an IP address"
+	}
+
+	return ""
+}
+
+func (r NameRules) trim(name string) string {
+	return strings.Trim(name, r.Separators)
+}
+
+func isAlphanumeric(c rune) bool {
+	return ('a' <= c && c <= 'z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameRules_Sanitize(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rules    NameRules
+		name     string
+		expected string
+	}{
+		"valid name": {
+			rules:    S3NameRules,
+			name:     "my-bucket.v1",
+			expected: "my-bucket.v1",
+		},
+		"uppercase and invalid characters": {
+			rules:    S3NameRules,
+			name:     "My_Bucket/Ünïcode",
+			expected: "my-bucket-n-code",
+		},
+		"separators at both ends": {
+			rules:    S3NameRules,
+			name:     "-.bucket.-",
+			expected: "bucket",
+		},
+		"consecutive separators": {
+			rules:    S3NameRules,
+			name:     "a--b..c-.d",
+			expected: "a-b.c-d",
+		},
+		"dots are not allowed in azure": {
+			rules:    AzureNameRules,
+			name:     "my.bucket_v1",
+			expected: "my-bucket-v1",
+		},
+		"underscores are allowed in gcs": {
+			rules:    GCSNameRules,
+			name:     "My_Bucket",
+			expected: "my_bucket",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, tc.rules.Sanitize(tc.name))
+		})
+	}
+}
+
+func TestNameRules_Truncate(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "bucket", S3NameRules.Truncate("bucket"))
+	assert.Equal(t, strings.Repeat("a", 62), S3NameRules.Truncate(strings.Repeat("a", 62)+"-b"))
+}
+
+func TestNameRules_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rules       NameRules
+		name        string
+		expectedErr string
+	}{
+		"valid s3 name": {
+			rules: S3NameRules,
+			name:  "my-bucket.v1",
+		},
+		"too short": {
+			rules:       S3NameRules,
+			name:        "ab",
+			expectedErr: "must be between 3 and 63 characters long",
+		},
+		"too long": {
+			rules:       AzureNameRules,
+			name:        strings.Repeat("a", 64),
+			expectedErr: "must be between 3 and 63 characters long",
+		},
+		"uppercase": {
+			rules:       S3NameRules,
+			name:        "MyBucket",
+			expectedErr: `must only contain lowercase letters, digits and "-."`,
+		},
+		"leading separator": {
+			rules:       S3NameRules,
+			name:        "-bucket",
+			expectedErr: "must start and end with a letter or digit",
+		},
+		"consecutive separators": {
+			rules:       AzureNameRules,
+			name:        "my--bucket",
+			expectedErr: "must not contain consecutive separators",
+		},
+		"dot in azure": {
+			rules:       AzureNameRules,
+			name:        "my.bucket",
+			expectedErr: `must only contain lowercase letters, digits and "-"`,
+		},
+		"ip address": {
+			rules:       S3NameRules,
+			name:        "192.168.5.4",
+			expectedErr: "must not be formatted as an IP address",
+		},
+		"reserved s3 prefix": {
+			rules:       S3NameRules,
+			name:        "xn--bucket",
+			expectedErr: `must not start with "xn--"`,
+		},
+		"reserved s3 suffix": {
+			rules:       S3NameRules,
+			name:        "bucket-s3alias",
+			expectedErr: `must not end with "-s3alias"`,
+		},
+		"reserved gcs word": {
+			rules:       GCSNameRules,
+			name:        "my-google-bucket",
+			expectedErr: `must not contain "google"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.rules.Validate(tc.name)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidBucketName)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
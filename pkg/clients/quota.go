@@ -0,0 +1,72 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QuotaKey is the BucketClass parameter holding the maximum total size of the objects of a bucket,
+// for clients supporting quotas. Its value is a quantity as parsed by ParseQuantity, e.g. "10Gi".
+const QuotaKey = "quota"
+
+// ParseQuantity parses a quantity of bytes written as the quantities of Kubernetes resources, e.g. "512Mi",
+// "10G" or "1e9", with resource.ParseQuantity. The quantity must be a whole, non-negative number of bytes.
+// Like Kubernetes, binary quantities larger than the largest int64 are capped to it.
+func ParseQuantity(s string) (int64, error) {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q: %w", s, err)
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("invalid quantity %q: must not be negative", s)
+	}
+	if !q.RoundUp(0) {
+		return 0, fmt.Errorf("invalid quantity %q: must be a whole number of bytes", s)
+	}
+
+	if n, ok := q.AsInt64(); ok {
+		return n, nil
+	}
+	// Quantities with a fraction or many digits are held as decimals, whose scale is zero once rounded.
+	if d := q.AsDec(); d.Scale() == 0 {
+		if n, ok := d.Unscaled(); ok {
+			return n, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid quantity %q: too large", s)
+}
+
+// ParseQuota returns the quota in bytes set by the QuotaKey parameter, or zero when it is not set.
+// Other parameters are ignored. The quota must be positive.
+func ParseQuota(params map[string]string) (int64, error) {
+	v := params[QuotaKey]
+	if v == "" {
+		return 0, nil
+	}
+
+	quota, err := ParseQuantity(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %w", QuotaKey, err)
+	}
+	if quota == 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be positive", QuotaKey, v)
+	}
+
+	return quota, nil
+}
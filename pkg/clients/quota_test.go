@@ -0,0 +1,187 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuantity(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value       string
+		expected    int64
+		expectedErr string
+	}{
+		"bytes": {
+			value:    "1024",
+			expected: 1024,
+		},
+		"zero": {
+			value:    "0",
+			expected: 0,
+		},
+		"binary suffix": {
+			value:    "10Gi",
+			expected: 10 << 30,
+		},
+		"largest binary suffix": {
+			value:    "7Ei",
+			expected: 7 << 60,
+		},
+		"decimal suffix": {
+			value:    "500M",
+			expected: 500_000_000,
+		},
+		"kilo": {
+			value:    "2k",
+			expected: 2000,
+		},
+		"exa": {
+			value:    "1E",
+			expected: 1_000_000_000_000_000_000,
+		},
+		"exponent": {
+			value:    "1e9",
+			expected: 1_000_000_000,
+		},
+		"uppercase exponent": {
+			value:    "5E3",
+			expected: 5000,
+		},
+		"fraction": {
+			value:    "1.5Gi",
+			expected: 3 << 29,
+		},
+		"leading dot": {
+			value:    ".5Ki",
+			expected: 512,
+		},
+		"fraction of byte": {
+			value:       "0.1",
+			expectedErr: `invalid quantity "0.1": must be a whole number of bytes`,
+		},
+		"whole milli": {
+			value:    "2000m",
+			expected: 2,
+		},
+		"explicit sign": {
+			value:    "+1Ki",
+			expected: 1024,
+		},
+		"empty": {
+			value:       "",
+			expectedErr: `invalid quantity ""`,
+		},
+		"unit": {
+			value:       "10GB",
+			expectedErr: `invalid quantity "10GB"`,
+		},
+		"lowercase binary": {
+			value:       "10gi",
+			expectedErr: `invalid quantity "10gi"`,
+		},
+		"milli": {
+			value:       "100m",
+			expectedErr: `invalid quantity "100m": must be a whole number of bytes`,
+		},
+		"negative": {
+			value:       "-1Gi",
+			expectedErr: `invalid quantity "-1Gi": must not be negative`,
+		},
+		"spaces": {
+			value:       "10 Gi",
+			expectedErr: `invalid quantity "10 Gi"`,
+		},
+		"capped binary quantity": {
+			value:    "8Ei",
+			expected: math.MaxInt64,
+		},
+		"exponent overflow": {
+			value:       "1e19",
+			expectedErr: `invalid quantity "1e19": too large`,
+		},
+		"huge exponent": {
+			value:       "1e999999999",
+			expectedErr: `invalid quantity "1e999999999": too large`,
+		},
+		"exponent without value": {
+			value:       "1e",
+			expectedErr: `invalid quantity "1e"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ParseQuantity(tc.value)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params      map[string]string
+		expected    int64
+		expectedErr string
+	}{
+		"no quota": {
+			params: map[string]string{"region": "eu-west-1"},
+		},
+		"empty quota": {
+			params: map[string]string{QuotaKey: ""},
+		},
+		"quota": {
+			params:   map[string]string{QuotaKey: "10Gi"},
+			expected: 10 << 30,
+		},
+		"invalid quota": {
+			params: map[string]string{QuotaKey: "ten"},
+			expectedErr: `invalid quota value: invalid quantity "ten": ` +
+				`quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`,
+		},
+		"zero quota": {
+			params:      map[string]string{QuotaKey: "0Gi"},
+			expectedErr: `invalid quota value "0Gi": must be positive`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ParseQuota(tc.params)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/sigv4"
+)
+
+const (
+	// adminPath is the path of the MinIO admin API, served along with the S3 API.
+	adminPath = "/minio/admin/v3/"
+	// adminService is the service MinIO admin requests are signed for.
+	adminService = "s3"
+
+	// adminNoSuchQuota is returned by the admin API when the bucket has no quota.
+	adminNoSuchQuota = "XMinioAdminNoSuchQuotaConfiguration"
+	// hardQuota is the type of quotas rejecting writes once the bucket is full.
+	hardQuota = "hard"
+)
+
+// adminClient is a minimal client for the MinIO admin API. Only the calls needed
+// to manage bucket quotas are implemented.
+type adminClient struct {
+	endpoint string // Base URL of the S3 endpoint.
+	region   string // Region used in the request signature.
+	creds    sigv4.Credentials
+	http     *http.Client
+	now      func() time.Time
+}
+
+// AdminError is an error response returned by the MinIO admin API.
+type AdminError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+func (e *AdminError) Error() string {
+	return fmt.Sprintf("admin: %s: %s", e.Code, e.Message)
+}
+
+func isAdminError(err error, code string) bool {
+	var adminErr *AdminError
+	return errors.As(err, &adminErr) && adminErr.Code == code
+}
+
+// bucketQuota is the quota configuration of a bucket.
+type bucketQuota struct {
+	Quota uint64 `json:"quota"` // Superseded by Size, still set for older MinIO releases.
+	Size  uint64 `json:"size"`
+	Type  string `json:"quotatype"`
+}
+
+func newAdminClient(endpoint, region string, admin S3Credentials, ssl bool) *adminClient {
+	scheme := "http"
+	if ssl {
+		scheme = "https"
+	}
+
+	if region == "" {
+		region = defaultRegion
+	}
+
+	return &adminClient{
+		endpoint: scheme + "://" + endpoint + adminPath,
+		region:   region,
+		creds: sigv4.Credentials{
+			AccessKeyID:     admin.AccessKeyID,
+			SecretAccessKey: admin.AccessSecretKey,
+		},
+		http: http.DefaultClient,
+		now:  time.Now,
+	}
+}
+
+// do sends a single admin API call with in as JSON body, when in is not nil,
+// and decodes the JSON result into out, when out is not nil.
+func (c *adminClient) do(ctx context.Context, method, api string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("unable to encode %s request: %w", api, err)
+		}
+	}
+
+	u := c.endpoint + api + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create %s request: %w", api, err)
+	}
+	sigv4.Sign(req, body, c.creds, c.region, adminService, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", api, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // best effort call
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return adminError(api, resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode %s response: %w", api, err)
+	}
+
+	return nil
+}
+
+// adminError returns the error reported by the response of a failed admin API call.
+func adminError(api string, resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read %s response: %w", api, err)
+	}
+
+	adminErr := &AdminError{}
+	if err := json.Unmarshal(data, adminErr); err != nil || adminErr.Code == "" {
+		return fmt.Errorf("%s failed with status %d: %s", api, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return adminErr
+}
+
+// setBucketQuota sets a hard quota of size bytes on the bucket. A zero size removes the quota.
+func (c *adminClient) setBucketQuota(ctx context.Context, bucket string, size int64) error {
+	return c.do(ctx, http.MethodPut, "set-bucket-quota", url.Values{"bucket": {bucket}}, bucketQuota{
+		Quota: uint64(size),
+		Size:  uint64(size),
+		Type:  hardQuota,
+	}, nil)
+}
+
+// getBucketQuota returns the quota of the bucket in bytes, or zero if the bucket has no quota.
+func (c *adminClient) getBucketQuota(ctx context.Context, bucket string) (int64, error) {
+	var quota bucketQuota
+	err := c.do(ctx, http.MethodGet, "get-bucket-quota", url.Values{"bucket": {bucket}}, nil, &quota)
+	if isAdminError(err, adminNoSuchQuota) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if quota.Size == 0 {
+		quota.Size = quota.Quota
+	}
+	return int64(quota.Size), nil
+}
@@ -0,0 +1,478 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+const (
+	// defaultRegion is the region reported by S3 for buckets without a location constraint.
+	defaultRegion = "us-east-1"
+
+	versioningEnabled   = "Enabled"
+	versioningSuspended = "Suspended"
+
+	// Default encryption modes of the encryption parameter.
+	sseS3  = "SSE-S3"
+	sseKMS = "SSE-KMS"
+
+	// Algorithms of the default encryption modes, as configured on buckets.
+	sseS3Algorithm  = "AES256"
+	sseKMSAlgorithm = "aws:kms"
+
+	// forceDeleteTag is the bucket tag recording that the bucket was created with the forceDelete parameter,
+	// as DeleteBucket only receives the bucket name.
+	forceDeleteTag = "cosi.objectstorage.k8s.io/force-delete"
+
+	// lifecycleRuleID is the ID of the lifecycle rule holding the lifecycle parameters.
+	lifecycleRuleID = "cosi"
+
+	// Limits of S3 bucket tags.
+	maxTags           = 50
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+var (
+	// tagPattern matches the characters allowed in tag keys and values.
+	tagPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+	// reservedTagPrefixes are the prefixes of tag keys reserved to AWS and to the driver.
+	reservedTagPrefixes = []string{"aws:", "cosi.objectstorage.k8s.io/"}
+)
+
+// schema is the set of BucketClass parameters understood by CreateBucket.
+var schema = slices.Concat(clients.Schema{
+	{Name: regionKey, Type: clients.String},
+	{Name: objectLockingKey, Type: clients.Bool, Default: "false"},
+	{Name: retentionModeKey, Type: clients.String, Allowed: []string{"GOVERNANCE", "COMPLIANCE"}, Mutable: true},
+	{Name: retentionDaysKey, Type: clients.Int, Mutable: true},
+	{Name: retentionYearsKey, Type: clients.Int, Mutable: true},
+	{Name: versioningKey, Type: clients.String, Allowed: []string{"enabled", "suspended"}, Mutable: true},
+	{Name: encryptionKey, Type: clients.String, Allowed: []string{sseS3, sseKMS}, Mutable: true},
+	{Name: kmsKeyIDKey, Type: clients.String, Mutable: true},
+	{Name: forceDeleteKey, Type: clients.Bool, Default: "false", Mutable: true},
+	{Name: clients.TagsKey, Type: clients.String, Mutable: true},
+	{Name: clients.QuotaKey, Type: clients.Quantity, Mutable: true},
+}, clients.LifecycleSchema)
+
+// bucketConfig describes the configuration of a bucket, either as requested
+// by the BucketClass parameters or as read back from the S3 service.
+type bucketConfig struct {
+	Region         string            // Location of the bucket.
+	ObjectLocking  bool              // Whether object locking is enabled.
+	RetentionMode  string            // Default retention mode of new objects, empty without default retention.
+	RetentionDays  uint              // Default retention period in days, zero when set in years.
+	RetentionYears uint              // Default retention period in years, zero when set in days.
+	Versioning     string            // Versioning status, empty when versioning was never enabled.
+	Encryption     string            // Default server-side encryption algorithm, empty when not configured.
+	KMSKeyID       string            // KMS key of the default encryption, empty for the default key.
+	Lifecycle      clients.Lifecycle // Lifecycle rules of the objects.
+	Tags           map[string]string // Bucket tags, without the forceDeleteTag.
+	Quota          int64             // Hard quota in bytes, zero without quota.
+	ForceDelete    bool              // Whether DeleteBucket removes the objects of the bucket.
+}
+
+// immutableParams returns the parameters of the configuration that cannot be changed on an existing bucket.
+func (cfg bucketConfig) immutableParams() map[string]string {
+	return map[string]string{
+		regionKey:        cfg.Region,
+		objectLockingKey: strconv.FormatBool(cfg.ObjectLocking),
+	}
+}
+
+// parseParams converts BucketClass parameters into the expected bucket configuration.
+// Parameters not understood by CreateBucket are ignored.
+func parseParams(params map[string]string) (bucketConfig, error) {
+	cfg := bucketConfig{
+		Region: params[regionKey],
+	}
+
+	if ol := params[objectLockingKey]; ol != "" {
+		var err error
+		cfg.ObjectLocking, err = strconv.ParseBool(ol)
+		if err != nil {
+			return bucketConfig{}, fmt.Errorf("invalid %s value: %w", objectLockingKey, err)
+		}
+	}
+
+	switch v := params[versioningKey]; v {
+	case "":
+	case "enabled":
+		cfg.Versioning = versioningEnabled
+	case "suspended":
+		cfg.Versioning = versioningSuspended
+	default:
+		return bucketConfig{}, fmt.Errorf("invalid %s value: %q", versioningKey, v)
+	}
+
+	switch e := params[encryptionKey]; e {
+	case "":
+	case sseS3:
+		cfg.Encryption = sseS3Algorithm
+	case sseKMS:
+		cfg.Encryption = sseKMSAlgorithm
+	default:
+		return bucketConfig{}, fmt.Errorf("invalid %s value: %q", encryptionKey, e)
+	}
+
+	cfg.KMSKeyID = params[kmsKeyIDKey]
+	if cfg.KMSKeyID != "" && cfg.Encryption != sseKMSAlgorithm {
+		return bucketConfig{}, fmt.Errorf("%s requires %s %s", kmsKeyIDKey, encryptionKey, sseKMS)
+	}
+
+	// Object locking can only be enabled on versioned buckets, so S3 enables versioning with it.
+	if cfg.ObjectLocking {
+		if cfg.Versioning == versioningSuspended {
+			return bucketConfig{}, fmt.Errorf("%s cannot be suspended with %s", versioningKey, objectLockingKey)
+		}
+		cfg.Versioning = versioningEnabled
+	}
+
+	if err := cfg.parseRetention(params); err != nil {
+		return bucketConfig{}, err
+	}
+
+	rules, err := clients.ParseLifecycle(params)
+	if err != nil {
+		return bucketConfig{}, err
+	}
+	cfg.Lifecycle = rules
+	if cfg.Lifecycle.NoncurrentExpireAfterDays > 0 && cfg.Versioning == "" {
+		return bucketConfig{}, fmt.Errorf("%s requires %s", clients.NoncurrentExpireAfterDaysKey, versioningKey)
+	}
+
+	if fd := params[forceDeleteKey]; fd != "" {
+		var err error
+		cfg.ForceDelete, err = strconv.ParseBool(fd)
+		if err != nil {
+			return bucketConfig{}, fmt.Errorf("invalid %s value: %w", forceDeleteKey, err)
+		}
+	}
+
+	cfg.Tags, err = clients.ParseTags(params[clients.TagsKey])
+	if err != nil {
+		return bucketConfig{}, fmt.Errorf("invalid %s value: %w", clients.TagsKey, err)
+	}
+	if err := validateTags(cfg.Tags, cfg.ForceDelete); err != nil {
+		return bucketConfig{}, err
+	}
+
+	cfg.Quota, err = clients.ParseQuota(params)
+	if err != nil {
+		return bucketConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// validateTags checks the tags against the limits of S3 bucket tags, keeping room for the forceDeleteTag.
+func validateTags(tags map[string]string, forceDelete bool) error {
+	limit := maxTags
+	if forceDelete {
+		limit--
+	}
+	if len(tags) > limit {
+		return fmt.Errorf("too many tags: %d, at most %d are allowed", len(tags), limit)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		value := tags[key]
+		switch {
+		case utf8.RuneCountInString(key) > maxTagKeyLength:
+			return fmt.Errorf("tag key %q is longer than %d characters", key, maxTagKeyLength)
+		case utf8.RuneCountInString(value) > maxTagValueLength:
+			return fmt.Errorf("value of tag %q is longer than %d characters", key, maxTagValueLength)
+		case !tagPattern.MatchString(key) || !tagPattern.MatchString(value):
+			return fmt.Errorf("tag %q holds characters other than letters, numbers, spaces and _.:/=+-@", key)
+		}
+		for _, prefix := range reservedTagPrefixes {
+			if strings.HasPrefix(strings.ToLower(key), prefix) {
+				return fmt.Errorf("tag key %q uses the reserved prefix %q", key, prefix)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseRetention parses the default retention parameters, which require object locking.
+// The retention period is set either in days or in years.
+func (cfg *bucketConfig) parseRetention(params map[string]string) error {
+	mode, days, years := params[retentionModeKey], params[retentionDaysKey], params[retentionYearsKey]
+	if mode == "" && days == "" && years == "" {
+		return nil
+	}
+	if !cfg.ObjectLocking {
+		return fmt.Errorf("%s, %s and %s require %s",
+			retentionModeKey, retentionDaysKey, retentionYearsKey, objectLockingKey)
+	}
+
+	switch minio.RetentionMode(mode) {
+	case minio.Governance, minio.Compliance:
+		cfg.RetentionMode = mode
+	case "":
+		return fmt.Errorf("%s is required with a retention period", retentionModeKey)
+	default:
+		return fmt.Errorf("invalid %s value: %q", retentionModeKey, mode)
+	}
+
+	if (days == "") == (years == "") {
+		return fmt.Errorf("one of %s and %s is required with %s", retentionDaysKey, retentionYearsKey, retentionModeKey)
+	}
+	key, value, period := retentionDaysKey, days, &cfg.RetentionDays
+	if years != "" {
+		key, value, period = retentionYearsKey, years, &cfg.RetentionYears
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		return fmt.Errorf("invalid %s value %q: must be a positive number", key, value)
+	}
+	*period = uint(n)
+
+	return nil
+}
+
+// readConfig reads the current configuration of the bucket from the S3 service.
+// The quota is not read, as it is only served by the MinIO admin API.
+func (c *Client) readConfig(ctx context.Context, bucket string) (bucketConfig, error) {
+	cfg := bucketConfig{}
+
+	location, err := c.locator.GetBucketLocation(ctx, bucket)
+	if err != nil {
+		return bucketConfig{}, fmt.Errorf("unable to get bucket location: %w", err)
+	}
+	cfg.Region = location
+
+	objectLock, mode, validity, unit, err := c.s3.GetObjectLockConfig(ctx, bucket)
+	if err != nil && !isErrorCode(err, "ObjectLockConfigurationNotFoundError") {
+		return bucketConfig{}, fmt.Errorf("unable to get object lock configuration: %w", err)
+	}
+	cfg.ObjectLocking = objectLock == versioningEnabled
+	if mode != nil && validity != nil && unit != nil {
+		cfg.RetentionMode = string(*mode)
+		if *unit == minio.Years {
+			cfg.RetentionYears = *validity
+		} else {
+			cfg.RetentionDays = *validity
+		}
+	}
+
+	versioning, err := c.s3.GetBucketVersioning(ctx, bucket)
+	if err != nil {
+		return bucketConfig{}, fmt.Errorf("unable to get bucket versioning: %w", err)
+	}
+	cfg.Versioning = versioning.Status
+
+	encryption, err := c.s3.GetBucketEncryption(ctx, bucket)
+	if err != nil && !isErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return bucketConfig{}, fmt.Errorf("unable to get bucket encryption: %w", err)
+	}
+	if err == nil && len(encryption.Rules) > 0 {
+		cfg.Encryption = encryption.Rules[0].Apply.SSEAlgorithm
+		cfg.KMSKeyID = encryption.Rules[0].Apply.KmsMasterKeyID
+	}
+
+	rules, err := c.s3.GetBucketLifecycle(ctx, bucket)
+	if err != nil && !isErrorCode(err, "NoSuchLifecycleConfiguration") {
+		return bucketConfig{}, fmt.Errorf("unable to get bucket lifecycle: %w", err)
+	}
+	if err == nil {
+		cfg.Lifecycle = fromLifecycleConfig(rules)
+	}
+
+	tags, err := c.s3.GetBucketTagging(ctx, bucket)
+	if err != nil && !isErrorCode(err, "NoSuchTagSet") {
+		return bucketConfig{}, fmt.Errorf("unable to get bucket tags: %w", err)
+	}
+	if err == nil {
+		cfg.Tags = tags.ToMap()
+		cfg.ForceDelete = cfg.Tags[forceDeleteTag] == "true"
+		delete(cfg.Tags, forceDeleteTag)
+	}
+
+	return cfg, nil
+}
+
+// lifecycleConfig returns the lifecycle configuration of the rules, as a single rule applying to all objects.
+func lifecycleConfig(l clients.Lifecycle) *lifecycle.Configuration {
+	rule := lifecycle.Rule{
+		ID:     lifecycleRuleID,
+		Status: "Enabled",
+		Expiration: lifecycle.Expiration{
+			Days: lifecycle.ExpirationDays(l.ExpireAfterDays),
+		},
+		NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+			NoncurrentDays: lifecycle.ExpirationDays(l.NoncurrentExpireAfterDays),
+		},
+		AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: lifecycle.ExpirationDays(l.AbortIncompleteUploadAfterDays),
+		},
+		Transition: lifecycle.Transition{
+			Days:         lifecycle.ExpirationDays(l.TransitionAfterDays),
+			StorageClass: l.TransitionStorageClass,
+		},
+	}
+
+	return &lifecycle.Configuration{Rules: []lifecycle.Rule{rule}}
+}
+
+// fromLifecycleConfig returns the rules of the lifecycle configuration set by lifecycleConfig.
+// Rules added outside of the driver are not reported, while a disabled rule yields no rules.
+func fromLifecycleConfig(cfg *lifecycle.Configuration) clients.Lifecycle {
+	i := slices.IndexFunc(cfg.Rules, func(r lifecycle.Rule) bool { return r.ID == lifecycleRuleID })
+	if i < 0 || cfg.Rules[i].Status != "Enabled" {
+		return clients.Lifecycle{}
+	}
+
+	rule := cfg.Rules[i]
+	return clients.Lifecycle{
+		ExpireAfterDays:                int(rule.Expiration.Days),
+		NoncurrentExpireAfterDays:      int(rule.NoncurrentVersionExpiration.NoncurrentDays),
+		AbortIncompleteUploadAfterDays: int(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation),
+		TransitionAfterDays:            int(rule.Transition.Days),
+		TransitionStorageClass:         rule.Transition.StorageClass,
+	}
+}
+
+// encryption returns the default encryption mode of the bucket, SSE-S3 or SSE-KMS, and its KMS key.
+// The mode is empty if the bucket has no default encryption.
+func (c *Client) encryption(ctx context.Context, bucket string) (string, string, error) {
+	encryption, err := c.s3.GetBucketEncryption(ctx, bucket)
+	if isErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get bucket encryption: %w", err)
+	}
+	if len(encryption.Rules) == 0 {
+		return "", "", nil
+	}
+
+	apply := encryption.Rules[0].Apply
+	switch apply.SSEAlgorithm {
+	case sseS3Algorithm:
+		return sseS3, "", nil
+	case sseKMSAlgorithm:
+		return sseKMS, apply.KmsMasterKeyID, nil
+	default:
+		return apply.SSEAlgorithm, apply.KmsMasterKeyID, nil
+	}
+}
+
+// forceDelete reports whether the bucket was created with the forceDelete parameter.
+func (c *Client) forceDelete(ctx context.Context, bucket string) (bool, error) {
+	tags, err := c.s3.GetBucketTagging(ctx, bucket)
+	if isErrorCode(err, "NoSuchTagSet") {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get bucket tags: %w", err)
+	}
+
+	return tags.ToMap()[forceDeleteTag] == "true", nil
+}
+
+// drain removes all objects, object versions and delete markers of the bucket.
+// Object lock retention and legal holds are not bypassed: if protected versions remain,
+// the bucket is reported as not empty.
+func (c *Client) drain(ctx context.Context, bucket string) error {
+	var listErr error
+	objects := func(yield func(minio.ObjectInfo) bool) {
+		opts := minio.ListObjectsOptions{Recursive: true, WithVersions: true}
+		for o := range c.s3.ListObjectsIter(ctx, bucket, opts) {
+			if o.Err != nil {
+				listErr = o.Err
+				return
+			}
+			if !yield(o) {
+				return
+			}
+		}
+	}
+
+	results, err := c.s3.RemoveObjectsWithIter(ctx, bucket, objects, minio.RemoveObjectsOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to remove objects: %w", err)
+	}
+
+	var (
+		failed int
+		first  minio.RemoveObjectResult
+	)
+	for r := range results {
+		if r.Err == nil {
+			continue
+		}
+		if failed == 0 {
+			first = r
+		}
+		failed++
+	}
+
+	if listErr != nil {
+		return fmt.Errorf("unable to list objects: %w", listErr)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d object versions of %s could not be removed, e.g. %s (version %s): %v",
+			clients.ErrBucketNotEmpty, failed, bucket, first.ObjectName, first.ObjectVersionID, first.Err)
+	}
+
+	return ctx.Err()
+}
+
+// matches reports whether the actual configuration satisfies the expected one.
+func (expected bucketConfig) matches(actual bucketConfig) bool {
+	if normalizeRegion(expected.Region) != normalizeRegion(actual.Region) {
+		return false
+	}
+
+	return expected.ObjectLocking == actual.ObjectLocking &&
+		expected.RetentionMode == actual.RetentionMode &&
+		expected.RetentionDays == actual.RetentionDays &&
+		expected.RetentionYears == actual.RetentionYears &&
+		expected.Versioning == actual.Versioning &&
+		expected.Encryption == actual.Encryption &&
+		expected.KMSKeyID == actual.KMSKeyID &&
+		expected.Lifecycle == actual.Lifecycle &&
+		expected.ForceDelete == actual.ForceDelete &&
+		expected.Quota == actual.Quota &&
+		clients.HasTags(actual.Tags, expected.Tags)
+}
+
+func normalizeRegion(region string) string {
+	if region == "" {
+		return defaultRegion
+	}
+	return region
+}
+
+// isErrorCode reports whether err is an S3 error response with the given code.
+func isErrorCode(err error, code string) bool {
+	return minio.ToErrorResponse(err).Code == code
+}
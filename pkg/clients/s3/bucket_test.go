@@ -0,0 +1,914 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+func TestClient_IsBucketEqual(t *testing.T) {
+	t.Parallel()
+
+	const (
+		taggingDoc    = `<Tagging><TagSet><Tag><Key>team</Key><Value>a</Value></Tag></TagSet></Tagging>`
+		encryptionDoc = `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault>` +
+			`<SSEAlgorithm>AES256</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`
+	)
+
+	tests := map[string]struct {
+		created   map[string]string
+		modify    func(f *fakeS3)
+		params    map[string]string
+		expected  bool
+		immutable bool // Whether an immutable parameter differs.
+	}{
+		"default bucket": {
+			created:  nil,
+			params:   nil,
+			expected: true,
+		},
+		"matching parameters": {
+			created:  map[string]string{"region": "eu-west-1", "objectLocking": "true"},
+			params:   map[string]string{"region": "eu-west-1", "objectLocking": "true"},
+			expected: true,
+		},
+		"explicit default region": {
+			created:  nil,
+			params:   map[string]string{"region": "us-east-1", "objectLocking": "false"},
+			expected: true,
+		},
+		"different region": {
+			created:   map[string]string{"region": "eu-west-1"},
+			params:    map[string]string{"region": "eu-central-1"},
+			expected:  false,
+			immutable: true,
+		},
+		"missing object locking": {
+			created:   nil,
+			params:    map[string]string{"objectLocking": "true"},
+			expected:  false,
+			immutable: true,
+		},
+		"unexpected object locking": {
+			created:   map[string]string{"objectLocking": "true"},
+			params:    nil,
+			expected:  false,
+			immutable: true,
+		},
+		"unexpected versioning": {
+			created: nil,
+			modify: func(f *fakeS3) {
+				f.set("bucket", "versioning", `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`)
+			},
+			params:   nil,
+			expected: false,
+		},
+		"matching versioning": {
+			created:  map[string]string{"versioning": "enabled"},
+			params:   map[string]string{"versioning": "enabled"},
+			expected: true,
+		},
+		"versioning implied by object locking": {
+			created:  map[string]string{"objectLocking": "true"},
+			params:   map[string]string{"objectLocking": "true", "versioning": "enabled"},
+			expected: true,
+		},
+		"suspended versioning": {
+			created:  map[string]string{"versioning": "suspended"},
+			params:   map[string]string{"versioning": "enabled"},
+			expected: false,
+		},
+		"missing versioning": {
+			created:  nil,
+			params:   map[string]string{"versioning": "suspended"},
+			expected: false,
+		},
+		"unexpected encryption": {
+			created: nil,
+			modify: func(f *fakeS3) {
+				f.set("bucket", "encryption", encryptionDoc)
+			},
+			params:   nil,
+			expected: false,
+		},
+		"matching encryption": {
+			created:  map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "key-1"},
+			params:   map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "key-1"},
+			expected: true,
+		},
+		"different encryption mode": {
+			created:  map[string]string{"encryption": "SSE-S3"},
+			params:   map[string]string{"encryption": "SSE-KMS"},
+			expected: false,
+		},
+		"different kms key": {
+			created:  map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "key-1"},
+			params:   map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "key-2"},
+			expected: false,
+		},
+		"tags missing from the parameters": {
+			created: nil,
+			modify: func(f *fakeS3) {
+				f.set("bucket", "tagging", taggingDoc)
+			},
+			params:   nil,
+			expected: true,
+		},
+		"matching force delete": {
+			created:  map[string]string{"forceDelete": "true"},
+			params:   map[string]string{"forceDelete": "true"},
+			expected: true,
+		},
+		"unexpected force delete": {
+			created:  map[string]string{"forceDelete": "true"},
+			params:   nil,
+			expected: false,
+		},
+		"unknown parameter": {
+			created:  nil,
+			params:   map[string]string{"unknown": "value"},
+			expected: false,
+		},
+		"invalid parameter": {
+			created:  nil,
+			params:   map[string]string{"objectLocking": "maybe"},
+			expected: false,
+		},
+		"matching tags": {
+			created:  map[string]string{"tags": "team=a,env=prod", "forceDelete": "true"},
+			params:   map[string]string{"tags": "env=prod, team=a", "forceDelete": "true"},
+			expected: true,
+		},
+		"different tags": {
+			created:  map[string]string{"tags": "team=a"},
+			params:   map[string]string{"tags": "team=b"},
+			expected: false,
+		},
+		"missing tags": {
+			created:  map[string]string{"tags": "team=a"},
+			params:   map[string]string{"tags": "team=a,env=prod"},
+			expected: false,
+		},
+		"matching retention": {
+			created:  map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			params:   map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			expected: true,
+		},
+		"different retention period": {
+			created:  map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			params:   map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionYears": "30"},
+			expected: false,
+		},
+		"missing retention": {
+			created:  map[string]string{"objectLocking": "true"},
+			params:   map[string]string{"objectLocking": "true", "retentionMode": "COMPLIANCE", "retentionDays": "1"},
+			expected: false,
+		},
+		"same quota in other units": {
+			created:  map[string]string{"quota": "1Gi"},
+			params:   map[string]string{"quota": "1024Mi"},
+			expected: true,
+		},
+		"different quota": {
+			created:  map[string]string{"quota": "1Gi"},
+			params:   map[string]string{"quota": "2Gi"},
+			expected: false,
+		},
+		"missing quota": {
+			created:  nil,
+			params:   map[string]string{"quota": "1Gi"},
+			expected: false,
+		},
+		"quota missing from the parameters": {
+			created:  map[string]string{"quota": "1Gi"},
+			params:   nil,
+			expected: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			require.NoError(t, client.CreateBucket(context.Background(), "bucket", tc.created))
+			if tc.modify != nil {
+				tc.modify(f)
+			}
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			if tc.immutable {
+				assert.ErrorIs(t, err, clients.ErrBucketAlreadyExists)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, equal)
+		})
+	}
+}
+
+func TestClient_IsBucketEqual_Error(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeS3Client(t, "us-east-1", "")
+	require.NoError(t, client.CreateBucket(context.Background(), "bucket", nil))
+	f.fail["GET versioning"] = "AccessDenied"
+
+	_, err := client.IsBucketEqual(context.Background(), "bucket", nil)
+	assert.ErrorContains(t, err, "unable to get bucket versioning")
+}
+
+func TestClient_CreateBucket_InvalidObjectLocking(t *testing.T) {
+	t.Parallel()
+
+	_, client := newFakeS3Client(t, "us-east-1", "")
+
+	err := client.CreateBucket(context.Background(), "bucket", map[string]string{"objectLocking": "maybe"})
+	assert.ErrorContains(t, err, "invalid objectLocking value")
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_DeleteBucket(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params        map[string]string
+		versions      []fakeVersion
+		expectedError error
+		remaining     int
+	}{
+		"empty bucket": {},
+		"non-empty bucket": {
+			versions:      []fakeVersion{{key: "a", versionID: "1"}},
+			expectedError: clients.ErrBucketNotEmpty,
+			remaining:     1,
+		},
+		"non-empty bucket with force delete": {
+			params: map[string]string{"forceDelete": "true"},
+			versions: []fakeVersion{
+				{key: "a", versionID: "1"},
+				{key: "a", versionID: "2"},
+				{key: "dir/b", versionID: "null"},
+			},
+		},
+		"locked versions with force delete": {
+			params: map[string]string{"objectLocking": "true", "forceDelete": "true"},
+			versions: []fakeVersion{
+				{key: "a", versionID: "1", locked: true},
+				{key: "a", versionID: "2"},
+				{key: "b", versionID: "1"},
+			},
+			expectedError: clients.ErrBucketNotEmpty,
+			remaining:     1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			require.NoError(t, client.CreateBucket(context.Background(), "bucket", tc.params))
+			for _, v := range tc.versions {
+				f.putVersion("bucket", v)
+			}
+
+			err := client.DeleteBucket(context.Background(), "bucket")
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.True(t, f.exists("bucket"))
+				assert.Len(t, f.versions("bucket"), tc.remaining)
+				return
+			}
+			require.NoError(t, err)
+			assert.False(t, f.exists("bucket"))
+		})
+	}
+}
+
+func TestClient_CreateBucket_InvalidForceDelete(t *testing.T) {
+	t.Parallel()
+
+	_, client := newFakeS3Client(t, "us-east-1", "")
+
+	err := client.CreateBucket(context.Background(), "bucket", map[string]string{"forceDelete": "maybe"})
+	assert.ErrorContains(t, err, "invalid forceDelete value")
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+}
+
+func TestClient_CreateBucket_Versioning(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params         map[string]string
+		fail           string
+		expectedStatus string
+		expectedError  error
+	}{
+		"enabled": {
+			params:         map[string]string{"versioning": "enabled"},
+			expectedStatus: "Enabled",
+		},
+		"suspended": {
+			params:         map[string]string{"versioning": "suspended"},
+			expectedStatus: "Suspended",
+		},
+		"enabled with object locking": {
+			params:         map[string]string{"versioning": "enabled", "objectLocking": "true"},
+			expectedStatus: "Enabled",
+		},
+		"suspended with object locking": {
+			params:        map[string]string{"versioning": "suspended", "objectLocking": "true"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"invalid value": {
+			params:        map[string]string{"versioning": "on"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"rolled back on failure": {
+			params:        map[string]string{"versioning": "enabled"},
+			fail:          "PUT versioning",
+			expectedError: clients.ErrPermissionDenied,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			if tc.fail != "" {
+				f.fail[tc.fail] = "AccessDenied"
+			}
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+
+			doc, _ := f.get("bucket", "versioning")
+			assert.Contains(t, doc, "<Status>"+tc.expectedStatus+"</Status>")
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+}
+
+func TestClient_CreateBucket_Encryption(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params        map[string]string
+		expectedDoc   []string
+		expectedError error
+	}{
+		"SSE-S3": {
+			params:      map[string]string{"encryption": "SSE-S3"},
+			expectedDoc: []string{"<SSEAlgorithm>AES256</SSEAlgorithm>"},
+		},
+		"SSE-KMS with default key": {
+			params:      map[string]string{"encryption": "SSE-KMS"},
+			expectedDoc: []string{"<SSEAlgorithm>aws:kms</SSEAlgorithm>"},
+		},
+		"SSE-KMS with key": {
+			params: map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "arn:aws:kms:us-east-1:111122223333:key/k"},
+			expectedDoc: []string{
+				"<SSEAlgorithm>aws:kms</SSEAlgorithm>",
+				"<KMSMasterKeyID>arn:aws:kms:us-east-1:111122223333:key/k</KMSMasterKeyID>",
+			},
+		},
+		"kms key without SSE-KMS": {
+			params:        map[string]string{"encryption": "SSE-S3", "kmsKeyId": "key"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"invalid mode": {
+			params:        map[string]string{"encryption": "AES256"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+
+			doc, _ := f.get("bucket", "encryption")
+			for _, expected := range tc.expectedDoc {
+				assert.Contains(t, doc, expected)
+			}
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+
+	t.Run("rolled back on failure", func(t *testing.T) {
+		t.Parallel()
+
+		f, client := newFakeS3Client(t, "us-east-1", "")
+		f.fail["PUT encryption"] = "AccessDenied"
+
+		err := client.CreateBucket(context.Background(), "bucket", map[string]string{"encryption": "SSE-S3"})
+		assert.ErrorIs(t, err, clients.ErrPermissionDenied)
+		assert.False(t, f.exists("bucket"))
+	})
+}
+
+func TestClient_CreateBucket_Lifecycle(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params        map[string]string
+		fail          string
+		expectedDoc   []string
+		expectedError error
+	}{
+		"expiration": {
+			params:      map[string]string{"expireAfterDays": "30", "abortIncompleteUploadAfterDays": "7"},
+			expectedDoc: []string{"<ID>cosi</ID>", "<Expiration><Days>30</Days></Expiration>", "<DaysAfterInitiation>7<"},
+		},
+		"noncurrent versions": {
+			params:      map[string]string{"versioning": "enabled", "noncurrentExpireAfterDays": "10"},
+			expectedDoc: []string{"<NoncurrentDays>10</NoncurrentDays>"},
+		},
+		"transition": {
+			params: map[string]string{
+				"transitionAfterDays": "30", "transitionStorageClass": "GLACIER", "expireAfterDays": "365",
+			},
+			expectedDoc: []string{"<StorageClass>GLACIER</StorageClass><Days>30</Days>", "<Days>365</Days>"},
+		},
+		"noncurrent versions without versioning": {
+			params:        map[string]string{"noncurrentExpireAfterDays": "10"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"transition without storage class": {
+			params:        map[string]string{"transitionAfterDays": "30"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"expiration before transition": {
+			params: map[string]string{
+				"transitionAfterDays": "30", "transitionStorageClass": "GLACIER", "expireAfterDays": "30",
+			},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"invalid days": {
+			params:        map[string]string{"expireAfterDays": "0"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"rolled back on failure": {
+			params:        map[string]string{"expireAfterDays": "30"},
+			fail:          "PUT lifecycle",
+			expectedError: clients.ErrPermissionDenied,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			if tc.fail != "" {
+				f.fail[tc.fail] = "AccessDenied"
+			}
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+
+			doc, _ := f.get("bucket", "lifecycle")
+			for _, expected := range tc.expectedDoc {
+				assert.Contains(t, doc, expected)
+			}
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+}
+
+func TestClient_IsBucketEqual_LifecycleDrift(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	params := map[string]string{"expireAfterDays": "30"}
+
+	tests := map[string]struct {
+		doc      string
+		expected bool
+	}{
+		"unchanged": {
+			doc: `<LifecycleConfiguration><Rule><ID>cosi</ID><Status>Enabled</Status>` +
+				`<Expiration><Days>30</Days></Expiration></Rule></LifecycleConfiguration>`,
+			expected: true,
+		},
+		"other rules": {
+			doc: `<LifecycleConfiguration><Rule><ID>cosi</ID><Status>Enabled</Status>` +
+				`<Expiration><Days>30</Days></Expiration></Rule><Rule><ID>logs</ID><Status>Enabled</Status>` +
+				`<Filter><Prefix>logs/</Prefix></Filter><Expiration><Days>1</Days></Expiration></Rule>` +
+				`</LifecycleConfiguration>`,
+			expected: true,
+		},
+		"changed days": {
+			doc: `<LifecycleConfiguration><Rule><ID>cosi</ID><Status>Enabled</Status>` +
+				`<Expiration><Days>60</Days></Expiration></Rule></LifecycleConfiguration>`,
+		},
+		"disabled rule": {
+			doc: `<LifecycleConfiguration><Rule><ID>cosi</ID><Status>Disabled</Status>` +
+				`<Expiration><Days>30</Days></Expiration></Rule></LifecycleConfiguration>`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			require.NoError(t, client.CreateBucket(ctx, "bucket", params))
+			f.set("bucket", "lifecycle", tc.doc)
+
+			equal, err := client.IsBucketEqual(ctx, "bucket", params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, equal)
+		})
+	}
+
+	t.Run("removed rules", func(t *testing.T) {
+		t.Parallel()
+
+		f, client := newFakeS3Client(t, "us-east-1", "")
+		require.NoError(t, client.CreateBucket(ctx, "bucket", params))
+		f.remove("bucket", "lifecycle")
+
+		equal, err := client.IsBucketEqual(ctx, "bucket", params)
+		require.NoError(t, err)
+		assert.False(t, equal)
+	})
+}
+
+func TestClient_CreateBucket_Retention(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params        map[string]string
+		fail          string
+		expectedDoc   string
+		expectedError error
+	}{
+		"governance in days": {
+			params:      map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			expectedDoc: "<DefaultRetention><Mode>GOVERNANCE</Mode><Days>30</Days></DefaultRetention>",
+		},
+		"compliance in years": {
+			params:      map[string]string{"objectLocking": "true", "retentionMode": "COMPLIANCE", "retentionYears": "7"},
+			expectedDoc: "<DefaultRetention><Mode>COMPLIANCE</Mode><Years>7</Years></DefaultRetention>",
+		},
+		"without object locking": {
+			params:        map[string]string{"retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"object locking disabled": {
+			params:        map[string]string{"objectLocking": "false", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"mode without period": {
+			params:        map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"period without mode": {
+			params:        map[string]string{"objectLocking": "true", "retentionDays": "30"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"days and years": {
+			params: map[string]string{
+				"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30", "retentionYears": "1",
+			},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"invalid mode": {
+			params:        map[string]string{"objectLocking": "true", "retentionMode": "governance", "retentionDays": "30"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"zero days": {
+			params:        map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "0"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"rolled back on failure": {
+			params:        map[string]string{"objectLocking": "true", "retentionMode": "GOVERNANCE", "retentionDays": "30"},
+			fail:          "PUT object-lock",
+			expectedError: clients.ErrPermissionDenied,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			if tc.fail != "" {
+				f.fail[tc.fail] = "AccessDenied"
+			}
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+
+			doc, _ := f.get("bucket", "object-lock")
+			assert.Contains(t, doc, "<ObjectLockEnabled>Enabled</ObjectLockEnabled>")
+			assert.Contains(t, doc, tc.expectedDoc)
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+}
+
+func TestClient_CreateBucket_Tags(t *testing.T) {
+	t.Parallel()
+
+	manyTags := func(n int) string {
+		entries := make([]string, n)
+		for i := range entries {
+			entries[i] = fmt.Sprintf("key%d=value", i)
+		}
+		return strings.Join(entries, ",")
+	}
+
+	tests := map[string]struct {
+		params        map[string]string
+		fail          string
+		expectedDoc   []string
+		expectedError string
+	}{
+		"tags": {
+			params: map[string]string{"tags": "team=storage,cost center=1234"},
+			expectedDoc: []string{
+				"<Tag><Key>cost center</Key><Value>1234</Value></Tag>",
+				"<Tag><Key>team</Key><Value>storage</Value></Tag>",
+			},
+		},
+		"tags with force delete": {
+			params: map[string]string{"tags": "team=storage", "forceDelete": "true"},
+			expectedDoc: []string{
+				"<Tag><Key>team</Key><Value>storage</Value></Tag>",
+				"<Tag><Key>cosi.objectstorage.k8s.io/force-delete</Key><Value>true</Value></Tag>",
+			},
+		},
+		"maximum number of tags": {
+			params:      map[string]string{"tags": manyTags(50)},
+			expectedDoc: []string{"<Key>key49</Key>"},
+		},
+		"too many tags": {
+			params:        map[string]string{"tags": manyTags(51)},
+			expectedError: "too many tags: 51, at most 50 are allowed",
+		},
+		"too many tags with force delete": {
+			params:        map[string]string{"tags": manyTags(50), "forceDelete": "true"},
+			expectedError: "too many tags: 50, at most 49 are allowed",
+		},
+		"malformed tags": {
+			params:        map[string]string{"tags": "team"},
+			expectedError: `invalid tags value: invalid tag "team": must be key=value`,
+		},
+		"duplicate tag": {
+			params:        map[string]string{"tags": "team=a,team=b"},
+			expectedError: `duplicate tag "team"`,
+		},
+		"long key": {
+			params:        map[string]string{"tags": strings.Repeat("k", 129) + "=value"},
+			expectedError: "is longer than 128 characters",
+		},
+		"long value": {
+			params:        map[string]string{"tags": "team=" + strings.Repeat("v", 257)},
+			expectedError: `value of tag "team" is longer than 256 characters`,
+		},
+		"invalid characters": {
+			params:        map[string]string{"tags": "team=a&b"},
+			expectedError: `tag "team" holds characters other than letters, numbers, spaces and _.:/=+-@`,
+		},
+		"reserved aws prefix": {
+			params:        map[string]string{"tags": "AWS:team=a"},
+			expectedError: `tag key "AWS:team" uses the reserved prefix "aws:"`,
+		},
+		"reserved driver prefix": {
+			params:        map[string]string{"tags": "cosi.objectstorage.k8s.io/force-delete=true"},
+			expectedError: `uses the reserved prefix "cosi.objectstorage.k8s.io/"`,
+		},
+		"rolled back on failure": {
+			params:        map[string]string{"tags": "team=storage"},
+			fail:          "PUT tagging",
+			expectedError: "AccessDenied",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			if tc.fail != "" {
+				f.fail[tc.fail] = "AccessDenied"
+			}
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				if tc.fail == "" {
+					assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+				}
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+
+			doc, _ := f.get("bucket", "tagging")
+			for _, expected := range tc.expectedDoc {
+				assert.Contains(t, doc, expected)
+			}
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+}
+
+func TestClient_CreateBucket_Quota(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params        map[string]string
+		fail          string
+		expectedDoc   string
+		expectedError error
+	}{
+		"binary quantity": {
+			params:      map[string]string{"quota": "10Gi"},
+			expectedDoc: `{"quota":10737418240,"size":10737418240,"quotatype":"hard"}`,
+		},
+		"decimal quantity": {
+			params:      map[string]string{"quota": "500M"},
+			expectedDoc: `{"quota":500000000,"size":500000000,"quotatype":"hard"}`,
+		},
+		"no quota": {
+			params: map[string]string{"versioning": "enabled"},
+		},
+		"invalid quantity": {
+			params:        map[string]string{"quota": "10GB"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"zero quota": {
+			params:        map[string]string{"quota": "0"},
+			expectedError: clients.ErrInvalidParameters,
+		},
+		"rolled back on failure": {
+			params:        map[string]string{"quota": "10Gi"},
+			fail:          "PUT set-bucket-quota",
+			expectedError: clients.ErrPermissionDenied,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			if tc.fail != "" {
+				f.fail[tc.fail] = "AccessDenied"
+			}
+
+			err := client.CreateBucket(context.Background(), "bucket", tc.params)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.False(t, f.exists("bucket"))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedDoc, f.quota("bucket"))
+
+			equal, err := client.IsBucketEqual(context.Background(), "bucket", tc.params)
+			require.NoError(t, err)
+			assert.True(t, equal)
+		})
+	}
+}
+
+func TestClient_QuotasDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	client, err := New(endpoint, "us-east-1", testAdmin, endpoint, false, false)
+	require.NoError(t, err)
+
+	err = client.CreateBucket(ctx, "bucket", map[string]string{"quota": "10Gi"})
+	assert.ErrorContains(t, err, "quota requires the MinIO admin API, which is disabled")
+	assert.ErrorIs(t, err, clients.ErrInvalidParameters)
+	assert.False(t, f.exists("bucket"))
+
+	// the admin API is never called, as the service may not serve it
+	f.fail["GET get-bucket-quota"] = "AccessDenied"
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+	equal, err := client.IsBucketEqual(ctx, "bucket", nil)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	equal, err = client.IsBucketEqual(ctx, "bucket", map[string]string{"quota": "10Gi"})
+	require.NoError(t, err)
+	assert.False(t, equal)
+}
+
+func TestClient_IsBucketEqual_QuotaDrift(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	params := map[string]string{"quota": "1Gi"}
+
+	tests := map[string]struct {
+		doc      string
+		expected bool
+	}{
+		"unchanged": {
+			doc:      `{"quota":1073741824,"size":1073741824,"quotatype":"hard"}`,
+			expected: true,
+		},
+		"older release": {
+			doc:      `{"quota":1073741824,"quotatype":"hard"}`,
+			expected: true,
+		},
+		"changed size": {
+			doc: `{"quota":2147483648,"size":2147483648,"quotatype":"hard"}`,
+		},
+		"removed quota": {
+			doc: "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, client := newFakeS3Client(t, "us-east-1", "")
+			require.NoError(t, client.CreateBucket(ctx, "bucket", params))
+			f.setQuota("bucket", tc.doc)
+
+			equal, err := client.IsBucketEqual(ctx, "bucket", params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, equal)
+		})
+	}
+
+	t.Run("admin API failure", func(t *testing.T) {
+		t.Parallel()
+
+		f, client := newFakeS3Client(t, "us-east-1", "")
+		require.NoError(t, client.CreateBucket(ctx, "bucket", params))
+		f.fail["GET get-bucket-quota"] = "AccessDenied"
+
+		_, err := client.IsBucketEqual(ctx, "bucket", params)
+		assert.ErrorIs(t, err, clients.ErrPermissionDenied)
+	})
+}
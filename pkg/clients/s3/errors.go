@@ -0,0 +1,67 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+// errorCodes maps the error codes of the S3, IAM and MinIO admin APIs to the errors of the clients package.
+var errorCodes = map[string]error{
+	"NoSuchBucket":            clients.ErrBucketNotFound,
+	"BucketAlreadyExists":     clients.ErrBucketAlreadyExists,
+	"BucketAlreadyOwnedByYou": clients.ErrBucketAlreadyExists,
+	"BucketNotEmpty":          clients.ErrBucketNotEmpty,
+	"AccessDenied":            clients.ErrPermissionDenied,
+	"InvalidAccessKeyId":      clients.ErrPermissionDenied,
+	"SignatureDoesNotMatch":   clients.ErrPermissionDenied,
+	"InvalidClientTokenId":    clients.ErrPermissionDenied,
+	"SlowDown":                clients.ErrThrottled,
+	"Throttling":              clients.ErrThrottled,
+	"ThrottlingException":     clients.ErrThrottled,
+	"RequestLimitExceeded":    clients.ErrThrottled,
+	"ServiceUnavailable":      clients.ErrThrottled,
+	"XMinioAdminNoSuchBucket": clients.ErrBucketNotFound,
+}
+
+// Unwrap returns the error of the clients package matching the code of the IAM error, if any.
+func (e *IAMError) Unwrap() error {
+	return errorCodes[e.Code]
+}
+
+// Unwrap returns the error of the clients package matching the code of the admin error, if any.
+func (e *AdminError) Unwrap() error {
+	return errorCodes[e.Code]
+}
+
+// wrapError wraps an error response of the S3 API with the matching error of the clients package,
+// so that callers can check it with errors.Is. Other errors are returned unchanged.
+func wrapError(err error) error {
+	var resp minio.ErrorResponse
+	if !errors.As(err, &resp) {
+		return err
+	}
+
+	target, ok := errorCodes[resp.Code]
+	if !ok || errors.Is(err, target) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", target, err)
+}
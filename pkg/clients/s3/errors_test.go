@@ -0,0 +1,102 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+)
+
+func TestWrapError(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err      error
+		expected error
+	}{
+		"no such bucket": {
+			err:      minio.ErrorResponse{Code: "NoSuchBucket"},
+			expected: clients.ErrBucketNotFound,
+		},
+		"bucket owned by another account": {
+			err:      minio.ErrorResponse{Code: "BucketAlreadyExists"},
+			expected: clients.ErrBucketAlreadyExists,
+		},
+		"bucket not empty": {
+			err:      minio.ErrorResponse{Code: "BucketNotEmpty"},
+			expected: clients.ErrBucketNotEmpty,
+		},
+		"access denied": {
+			err:      fmt.Errorf("unable to get bucket tags: %w", minio.ErrorResponse{Code: "AccessDenied"}),
+			expected: clients.ErrPermissionDenied,
+		},
+		"slow down": {
+			err:      minio.ErrorResponse{Code: "SlowDown"},
+			expected: clients.ErrThrottled,
+		},
+		"iam throttling": {
+			err:      &IAMError{Code: "Throttling"},
+			expected: clients.ErrThrottled,
+		},
+		"unknown code": {
+			err: minio.ErrorResponse{Code: "InternalError"},
+		},
+		"other error": {
+			err: errors.New("connection refused"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := wrapError(tc.err)
+			require.ErrorIs(t, err, tc.err)
+			for _, target := range []error{
+				clients.ErrBucketNotFound,
+				clients.ErrBucketAlreadyExists,
+				clients.ErrBucketNotEmpty,
+				clients.ErrPermissionDenied,
+				clients.ErrThrottled,
+			} {
+				assert.Equal(t, target == tc.expected, errors.Is(err, target), target)
+			}
+		})
+	}
+
+	assert.NoError(t, wrapError(nil))
+}
+
+func TestClient_Errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, client := newFakeS3Client(t, "us-east-1", "")
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+
+	err := client.CreateBucket(ctx, "bucket", nil)
+	assert.ErrorIs(t, err, clients.ErrBucketAlreadyExists)
+
+	err = client.DeleteBucket(ctx, "missing")
+	assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// subresources maps the bucket configuration subresources served by fakeS3
+// to the error code returned when they are not configured.
+var subresources = map[string]string{
+	"object-lock": "ObjectLockConfigurationNotFoundError",
+	"versioning":  "",
+	"encryption":  "ServerSideEncryptionConfigurationNotFoundError",
+	"tagging":     "NoSuchTagSet",
+	"lifecycle":   "NoSuchLifecycleConfiguration",
+}
+
+type fakeBucket struct {
+	region   string
+	config   map[string]string // subresource -> XML document
+	versions []fakeVersion     // object versions, in listing order
+	quota    string            // JSON quota configuration set through the admin API, empty without quota
+}
+
+type fakeVersion struct {
+	key       string
+	versionID string
+	locked    bool // protected by object lock retention or legal hold
+}
+
+// fakeS3 is an httptest stand-in for the bucket level S3 API, using path style requests,
+// and for the bucket quota calls of the MinIO admin API.
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]*fakeBucket
+	fail    map[string]string // "METHOD subresource" or "METHOD admin-call" -> error code
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		buckets: map[string]*fakeBucket{},
+		fail:    map[string]string{},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// newFakeS3Client returns a client talking to a new fakeS3 and, optionally, an IAM stand-in.
+// Without a stand-in, IAM requests are sent to fakeS3, which does not serve them.
+// Quotas are enabled, as fakeS3 serves the admin API.
+func newFakeS3Client(t *testing.T, region, iamURL string) (*fakeS3, *Client) {
+	f, srv := newFakeS3(t)
+	if iamURL == "" {
+		iamURL = srv.URL
+	}
+	endpoint, iamEndpoint := strings.TrimPrefix(srv.URL, "http://"), strings.TrimPrefix(iamURL, "http://")
+	client, err := New(endpoint, region, testAdmin, iamEndpoint, false, true)
+	require.NoError(t, err)
+	return f, client
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func subresource(r *http.Request) string {
+	for name := range subresources {
+		if r.URL.Query().Has(name) {
+			return name
+		}
+	}
+	for _, name := range []string{"location", "versions", "delete"} {
+		if r.URL.Query().Has(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if api, ok := strings.CutPrefix(r.URL.Path, adminPath); ok {
+		f.serveAdmin(w, r, api)
+		return
+	}
+
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	sub := subresource(r)
+	if code, ok := f.fail[r.Method+" "+sub]; ok {
+		s3Error(w, http.StatusForbidden, code)
+		return
+	}
+
+	b, exists := f.buckets[name]
+	if r.Method == http.MethodPut && sub == "" {
+		if exists {
+			s3Error(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+			return
+		}
+		f.createBucket(name, r)
+		return
+	}
+	if !exists {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead && sub == "":
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodDelete && sub == "":
+		if len(b.versions) > 0 {
+			s3Error(w, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(f.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && sub == "versions":
+		f.listVersions(w, name, b)
+
+	case r.Method == http.MethodPost && sub == "delete":
+		f.deleteObjects(w, r, b)
+
+	case r.Method == http.MethodGet && sub == "location":
+		region := b.region
+		if region == defaultRegion {
+			region = ""
+		}
+		fmt.Fprintf(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">%s</LocationConstraint>`, region)
+
+	case r.Method == http.MethodGet && sub == "versioning" && b.config[sub] == "":
+		fmt.Fprint(w, `<VersioningConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"/>`)
+
+	case r.Method == http.MethodGet && sub != "":
+		doc, ok := b.config[sub]
+		if !ok {
+			s3Error(w, http.StatusNotFound, subresources[sub])
+			return
+		}
+		fmt.Fprint(w, doc)
+
+	case r.Method == http.MethodPut && sub != "":
+		body, _ := io.ReadAll(r.Body)
+		b.config[sub] = string(body)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodDelete && sub != "":
+		delete(b.config, sub)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"Code":%q,"Message":%q}`, code, code)
+}
+
+// serveAdmin implements the bucket quota calls of the admin API, which must be signed with the admin credentials.
+func (f *fakeS3) serveAdmin(w http.ResponseWriter, r *http.Request, api string) {
+	body, _ := io.ReadAll(r.Body)
+	if !verifySignature(r, body, testAdmin, adminService) {
+		writeAdminError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	if code, ok := f.fail[r.Method+" "+api]; ok {
+		writeAdminError(w, http.StatusForbidden, code)
+		return
+	}
+
+	b, ok := f.buckets[r.URL.Query().Get("bucket")]
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, "XMinioAdminNoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && api == "set-bucket-quota":
+		b.quota = string(body)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet && api == "get-bucket-quota":
+		if b.quota == "" {
+			writeAdminError(w, http.StatusNotFound, adminNoSuchQuota)
+			return
+		}
+		fmt.Fprint(w, b.quota)
+
+	default:
+		writeAdminError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) createBucket(name string, r *http.Request) {
+	b := &fakeBucket{
+		region: defaultRegion,
+		config: map[string]string{},
+	}
+
+	var cfg struct {
+		Location string `xml:"LocationConstraint"`
+	}
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 && xml.Unmarshal(body, &cfg) == nil && cfg.Location != "" {
+		b.region = cfg.Location
+	}
+
+	if r.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true" {
+		b.config["object-lock"] = `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled>` +
+			`</ObjectLockConfiguration>`
+		b.config["versioning"] = `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`
+	}
+
+	f.buckets[name] = b
+}
+
+// set stores a raw configuration document of the bucket.
+func (f *fakeS3) set(bucket, sub, doc string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[bucket].config[sub] = doc
+}
+
+// remove deletes a configuration document of the bucket.
+func (f *fakeS3) remove(bucket, sub string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.buckets[bucket].config, sub)
+}
+
+// get returns a raw configuration document of the bucket.
+func (f *fakeS3) get(bucket, sub string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	doc, ok := f.buckets[bucket].config[sub]
+	return doc, ok
+}
+
+func (f *fakeS3) listVersions(w http.ResponseWriter, name string, b *fakeBucket) {
+	type version struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+		IsLatest  bool   `xml:"IsLatest"`
+		Size      int    `xml:"Size"`
+	}
+
+	result := struct {
+		XMLName     xml.Name  `xml:"ListVersionsResult"`
+		Name        string    `xml:"Name"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Versions    []version `xml:"Version"`
+	}{Name: name}
+	for _, v := range b.versions {
+		result.Versions = append(result.Versions, version{Key: v.key, VersionID: v.versionID, Size: 1})
+	}
+
+	data, _ := xml.Marshal(result)
+	w.Write(data) //nolint:errcheck // best effort call
+}
+
+// deleteObjects implements the multi-object delete, failing for locked versions.
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request, b *fakeBucket) {
+	var req struct {
+		Objects []struct {
+			Key       string `xml:"Key"`
+			VersionID string `xml:"VersionId"`
+		} `xml:"Object"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &req); err != nil {
+		s3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	type result struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+		Code      string `xml:"Code,omitempty"`
+		Message   string `xml:"Message,omitempty"`
+	}
+	var deleted, failed []result
+
+	for _, o := range req.Objects {
+		i := slices.IndexFunc(b.versions, func(v fakeVersion) bool {
+			return v.key == o.Key && v.versionID == o.VersionID
+		})
+		switch {
+		case i < 0:
+			deleted = append(deleted, result{Key: o.Key, VersionID: o.VersionID})
+		case b.versions[i].locked:
+			failed = append(failed, result{
+				Key: o.Key, VersionID: o.VersionID, Code: "AccessDenied", Message: "Object is WORM protected",
+			})
+		default:
+			b.versions = slices.Delete(b.versions, i, i+1)
+			deleted = append(deleted, result{Key: o.Key, VersionID: o.VersionID})
+		}
+	}
+
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []result `xml:"Deleted"`
+		Errors  []result `xml:"Error"`
+	}{Deleted: deleted, Errors: failed})
+	w.Write(data) //nolint:errcheck // best effort call
+}
+
+// quota returns the JSON quota configuration of the bucket, empty without quota.
+func (f *fakeS3) quota(bucket string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[bucket].quota
+}
+
+// setQuota replaces the JSON quota configuration of the bucket.
+func (f *fakeS3) setQuota(bucket, doc string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[bucket].quota = doc
+}
+
+// putVersion stores an object version in the bucket.
+func (f *fakeS3) putVersion(bucket string, v fakeVersion) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := f.buckets[bucket]
+	b.versions = append(b.versions, v)
+}
+
+// versions returns the object versions stored in the bucket.
+func (f *fakeS3) versions(bucket string) []fakeVersion {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.buckets[bucket].versions)
+}
+
+// exists reports whether the bucket exists.
+func (f *fakeS3) exists(bucket string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.buckets[bucket]
+	return ok
+}
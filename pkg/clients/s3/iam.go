@@ -0,0 +1,214 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/sigv4"
+)
+
+const (
+	iamAPIVersion = "2010-05-08"
+	iamService    = "iam"
+
+	// iamNoSuchEntity is returned by IAM when the referenced user, key or policy does not exist.
+	iamNoSuchEntity = "NoSuchEntity"
+	// iamEntityAlreadyExists is returned by IAM when the user being created already exists.
+	iamEntityAlreadyExists = "EntityAlreadyExists"
+)
+
+// iamClient is a minimal client for the AWS IAM query API. Only the calls needed
+// to manage per-access users are implemented.
+type iamClient struct {
+	endpoint string // Base URL of the IAM-compatible endpoint.
+	creds    sigv4.Credentials
+	http     *http.Client
+	now      func() time.Time
+}
+
+// IAMError is an error response returned by the IAM API.
+type IAMError struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+func (e *IAMError) Error() string {
+	return fmt.Sprintf("iam: %s: %s", e.Code, e.Message)
+}
+
+func isIAMError(err error, code string) bool {
+	var iamErr *IAMError
+	return errors.As(err, &iamErr) && iamErr.Code == code
+}
+
+func newIAMClient(endpoint string, admin S3Credentials, ssl bool) *iamClient {
+	scheme := "http"
+	if ssl {
+		scheme = "https"
+	}
+
+	return &iamClient{
+		endpoint: scheme + "://" + endpoint + "/",
+		creds: sigv4.Credentials{
+			AccessKeyID:     admin.AccessKeyID,
+			SecretAccessKey: admin.AccessSecretKey,
+		},
+		http: http.DefaultClient,
+		now:  time.Now,
+	}
+}
+
+// do sends a single IAM action and decodes the result into out, when out is not nil.
+func (c *iamClient) do(ctx context.Context, action string, params url.Values, out any) error {
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("Action", action)
+	form.Set("Version", iamAPIVersion)
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create %s request: %w", action, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	// IAM is a global service, whose requests are signed for us-east-1 whatever the region of the buckets.
+	sigv4.Sign(req, body, c.creds, defaultRegion, iamService, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", action, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // best effort call
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read %s response: %w", action, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		iamErr := &IAMError{}
+		if err := xml.Unmarshal(data, iamErr); err != nil || iamErr.Code == "" {
+			return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+		return iamErr
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unable to decode %s response: %w", action, err)
+	}
+
+	return nil
+}
+
+func (c *iamClient) createUser(ctx context.Context, name string) error {
+	return c.do(ctx, "CreateUser", url.Values{"UserName": {name}}, nil)
+}
+
+func (c *iamClient) deleteUser(ctx context.Context, name string) error {
+	return c.do(ctx, "DeleteUser", url.Values{"UserName": {name}}, nil)
+}
+
+func (c *iamClient) createAccessKey(ctx context.Context, name string) (S3Credentials, error) {
+	var out struct {
+		AccessKeyID     string `xml:"CreateAccessKeyResult>AccessKey>AccessKeyId"`
+		SecretAccessKey string `xml:"CreateAccessKeyResult>AccessKey>SecretAccessKey"`
+	}
+	if err := c.do(ctx, "CreateAccessKey", url.Values{"UserName": {name}}, &out); err != nil {
+		return S3Credentials{}, err
+	}
+
+	return S3Credentials{
+		AccessKeyID:     out.AccessKeyID,
+		AccessSecretKey: out.SecretAccessKey,
+	}, nil
+}
+
+func (c *iamClient) listAccessKeys(ctx context.Context, name string) ([]string, error) {
+	var out struct {
+		AccessKeyIDs []string `xml:"ListAccessKeysResult>AccessKeyMetadata>member>AccessKeyId"`
+	}
+	if err := c.do(ctx, "ListAccessKeys", url.Values{"UserName": {name}}, &out); err != nil {
+		return nil, err
+	}
+
+	return out.AccessKeyIDs, nil
+}
+
+func (c *iamClient) deleteAccessKey(ctx context.Context, name, keyID string) error {
+	return c.do(ctx, "DeleteAccessKey", url.Values{"UserName": {name}, "AccessKeyId": {keyID}}, nil)
+}
+
+func (c *iamClient) putUserPolicy(ctx context.Context, name, policyName, document string) error {
+	return c.do(ctx, "PutUserPolicy", url.Values{
+		"UserName":       {name},
+		"PolicyName":     {policyName},
+		"PolicyDocument": {document},
+	}, nil)
+}
+
+func (c *iamClient) deleteUserPolicy(ctx context.Context, name, policyName string) error {
+	return c.do(ctx, "DeleteUserPolicy", url.Values{"UserName": {name}, "PolicyName": {policyName}}, nil)
+}
+
+// policyName returns the name of the inline policy granting user access to the bucket.
+func policyName(bucket string) string {
+	return "cosi-" + bucket
+}
+
+// bucketPolicy returns an IAM policy document that grants full access to exactly one bucket.
+func bucketPolicy(bucket string) (string, error) {
+	type statement struct {
+		Effect   string   `json:"Effect"`
+		Action   []string `json:"Action"`
+		Resource []string `json:"Resource"`
+	}
+
+	doc, err := json.Marshal(struct {
+		Version   string      `json:"Version"`
+		Statement []statement `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+		Statement: []statement{{
+			Effect: "Allow",
+			Action: []string{"s3:*"},
+			Resource: []string{
+				"arn:aws:s3:::" + bucket,
+				"arn:aws:s3:::" + bucket + "/*",
+			},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(doc), nil
+}
@@ -0,0 +1,377 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/internal/sigv4"
+)
+
+var testAdmin = S3Credentials{
+	AccessKeyID:     "admin",
+	AccessSecretKey: "admin-secret",
+}
+
+type iamUser struct {
+	policies map[string]string
+	keys     []string
+}
+
+// fakeIAM is an httptest stand-in for an IAM-compatible endpoint.
+type fakeIAM struct {
+	mu      sync.Mutex
+	users   map[string]*iamUser
+	nextKey int
+	fail    map[string]string // action -> error code
+}
+
+func newFakeIAM(t *testing.T) (*fakeIAM, *httptest.Server) {
+	f := &fakeIAM{
+		users: map[string]*iamUser{},
+		fail:  map[string]string{},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeIAM) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<ErrorResponse><Error><Code>%s</Code><Message>%s</Message></Error></ErrorResponse>", code, code)
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !verifySignature(r, body, testAdmin, iamService) {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	// IAM only accepts requests signed for us-east-1.
+	if !strings.Contains(r.Header.Get("Authorization"), "/"+defaultRegion+"/"+iamService+"/") {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "MalformedInput")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	action := form.Get("Action")
+	if code, ok := f.fail[action]; ok {
+		f.writeError(w, http.StatusInternalServerError, code)
+		return
+	}
+
+	name := form.Get("UserName")
+	u, exists := f.users[name]
+	if action != "CreateUser" && !exists {
+		f.writeError(w, http.StatusNotFound, iamNoSuchEntity)
+		return
+	}
+
+	switch action {
+	case "CreateUser":
+		if exists {
+			f.writeError(w, http.StatusConflict, iamEntityAlreadyExists)
+			return
+		}
+		f.users[name] = &iamUser{policies: map[string]string{}}
+		fmt.Fprint(w, "<CreateUserResponse/>")
+
+	case "DeleteUser":
+		if len(u.policies) > 0 || len(u.keys) > 0 {
+			f.writeError(w, http.StatusConflict, "DeleteConflict")
+			return
+		}
+		delete(f.users, name)
+		fmt.Fprint(w, "<DeleteUserResponse/>")
+
+	case "PutUserPolicy":
+		u.policies[form.Get("PolicyName")] = form.Get("PolicyDocument")
+		fmt.Fprint(w, "<PutUserPolicyResponse/>")
+
+	case "DeleteUserPolicy":
+		if _, ok := u.policies[form.Get("PolicyName")]; !ok {
+			f.writeError(w, http.StatusNotFound, iamNoSuchEntity)
+			return
+		}
+		delete(u.policies, form.Get("PolicyName"))
+		fmt.Fprint(w, "<DeleteUserPolicyResponse/>")
+
+	case "CreateAccessKey":
+		f.nextKey++
+		id := fmt.Sprintf("KEY%d", f.nextKey)
+		u.keys = append(u.keys, id)
+		fmt.Fprintf(w, `<CreateAccessKeyResponse><CreateAccessKeyResult><AccessKey>
+<UserName>%s</UserName><AccessKeyId>%s</AccessKeyId><SecretAccessKey>secret-%s</SecretAccessKey>
+</AccessKey></CreateAccessKeyResult></CreateAccessKeyResponse>`, name, id, id)
+
+	case "ListAccessKeys":
+		var members strings.Builder
+		for _, k := range u.keys {
+			fmt.Fprintf(&members, "<member><AccessKeyId>%s</AccessKeyId></member>", k)
+		}
+		fmt.Fprintf(w, `<ListAccessKeysResponse><ListAccessKeysResult><AccessKeyMetadata>%s</AccessKeyMetadata>
+</ListAccessKeysResult></ListAccessKeysResponse>`, members.String())
+
+	case "DeleteAccessKey":
+		id := form.Get("AccessKeyId")
+		for i, k := range u.keys {
+			if k == id {
+				u.keys = append(u.keys[:i], u.keys[i+1:]...)
+				break
+			}
+		}
+		fmt.Fprint(w, "<DeleteAccessKeyResponse/>")
+
+	default:
+		f.writeError(w, http.StatusBadRequest, "InvalidAction")
+	}
+}
+
+// verifySignature checks the SigV4 Authorization header of the request.
+func verifySignature(r *http.Request, body []byte, creds S3Credentials, service string) bool {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), sigv4.Algorithm+" ")
+	fields := map[string]string{}
+	for _, part := range strings.Split(auth, ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		fields[k] = v
+	}
+
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[0] != creds.AccessKeyID || scope[3] != service {
+		return false
+	}
+
+	t, err := time.Parse(sigv4.TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	expected := sigv4.Signature(
+		r, strings.Split(fields["SignedHeaders"], ";"),
+		sigv4.HashHex(body), creds.AccessSecretKey, scope[2], service, t,
+	)
+	return expected == fields["Signature"]
+}
+
+// newTestClient returns a client talking to the IAM stand-in and a fakeS3 holding the buckets used by the tests.
+func newTestClient(t *testing.T, iamURL string) *Client {
+	_, client := newFakeS3Client(t, "us-east-1", iamURL)
+	for _, bucket := range []string{"bucket", "bucket-a", "bucket-b"} {
+		require.NoError(t, client.CreateBucket(context.Background(), bucket, nil))
+	}
+	return client
+}
+
+func TestClient_CreateBucketAccess_IAM(t *testing.T) {
+	t.Parallel()
+
+	iam, srv := newFakeIAM(t)
+	client := newTestClient(t, srv.URL)
+
+	first, err := client.CreateBucketAccess(context.Background(), "bucket-a", "user-a")
+	require.NoError(t, err)
+	assert.Equal(t, "user-a", first.Name())
+	assert.Equal(t, "s3", first.Platform())
+	assert.Equal(t, map[string]string{
+		"accessKeyId":     "KEY1",
+		"accessSecretKey": "secret-KEY1",
+	}, first.Credentials())
+
+	second, err := client.CreateBucketAccess(context.Background(), "bucket-b", "user-b")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Credentials(), second.Credentials())
+
+	iam.mu.Lock()
+	defer iam.mu.Unlock()
+	require.Contains(t, iam.users, "user-a")
+	require.Contains(t, iam.users["user-a"].policies, "cosi-bucket-a")
+	assert.Contains(t, iam.users["user-a"].policies["cosi-bucket-a"], `"arn:aws:s3:::bucket-a/*"`)
+	assert.NotContains(t, iam.users["user-a"].policies["cosi-bucket-a"], "bucket-b")
+}
+
+func TestClient_CreateBucketAccess_Region(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, srv := newFakeIAM(t)
+	_, client := newFakeS3Client(t, "eu-west-1", srv.URL)
+	require.NoError(t, client.CreateBucket(ctx, "bucket", nil))
+
+	_, err := client.CreateBucketAccess(ctx, "bucket", "user")
+	assert.NoError(t, err)
+}
+
+func TestNew_RequiresIAMEndpoint(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("s3.example.com", "us-east-1", testAdmin, "", true, false)
+	assert.Error(t, err)
+}
+
+func TestClient_CreateBucketAccess_Encryption(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, srv := newFakeIAM(t)
+	client := newTestClient(t, srv.URL)
+
+	params := map[string]string{"encryption": "SSE-KMS", "kmsKeyId": "key-1"}
+	require.NoError(t, client.CreateBucket(ctx, "encrypted", params))
+
+	user, err := client.CreateBucketAccess(ctx, "encrypted", "user")
+	require.NoError(t, err)
+	assert.Equal(t, "SSE-KMS", user.Credentials()["encryption"])
+	assert.Equal(t, "key-1", user.Credentials()["kmsKeyId"])
+
+	user, err = client.CreateBucketAccess(ctx, "bucket", "user")
+	require.NoError(t, err)
+	assert.NotContains(t, user.Credentials(), "encryption")
+
+	_, err = client.CreateBucketAccess(ctx, "missing", "user")
+	assert.ErrorIs(t, err, clients.ErrBucketNotFound)
+}
+
+func TestClient_CreateBucketAccess_Regrant(t *testing.T) {
+	t.Parallel()
+
+	iam, srv := newFakeIAM(t)
+	client := newTestClient(t, srv.URL)
+
+	_, err := client.CreateBucketAccess(context.Background(), "bucket", "user")
+	require.NoError(t, err)
+
+	user, err := client.CreateBucketAccess(context.Background(), "bucket", "user")
+	require.NoError(t, err)
+	assert.Equal(t, "KEY2", user.Credentials()["accessKeyId"])
+
+	iam.mu.Lock()
+	defer iam.mu.Unlock()
+	assert.Equal(t, []string{"KEY2"}, iam.users["user"].keys)
+}
+
+func TestClient_CreateBucketAccess_Cleanup(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fail          map[string]string
+		expectedError []string
+		expectedUser  bool
+	}{
+		"policy failure": {
+			fail:          map[string]string{"PutUserPolicy": "ServiceFailure"},
+			expectedError: []string{"ServiceFailure"},
+		},
+		"access key failure": {
+			fail:          map[string]string{"CreateAccessKey": "LimitExceeded"},
+			expectedError: []string{"LimitExceeded"},
+		},
+		"cleanup failure": {
+			fail:          map[string]string{"CreateAccessKey": "LimitExceeded", "DeleteUserPolicy": "ServiceFailure"},
+			expectedError: []string{"LimitExceeded", "unable to remove user user", "ServiceFailure"},
+			expectedUser:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			iam, srv := newFakeIAM(t)
+			client := newTestClient(t, srv.URL)
+			iam.mu.Lock()
+			maps.Copy(iam.fail, tc.fail)
+			iam.mu.Unlock()
+
+			_, err := client.CreateBucketAccess(context.Background(), "bucket", "user")
+			for _, expected := range tc.expectedError {
+				assert.ErrorContains(t, err, expected)
+			}
+
+			iam.mu.Lock()
+			defer iam.mu.Unlock()
+			_, exists := iam.users["user"]
+			assert.Equal(t, tc.expectedUser, exists)
+		})
+	}
+}
+
+func TestClient_DeleteBucketAccess_IAM(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		grant bool
+	}{
+		"existing user": {
+			grant: true,
+		},
+		"missing user": {
+			grant: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			iam, srv := newFakeIAM(t)
+			client := newTestClient(t, srv.URL)
+
+			if tc.grant {
+				_, err := client.CreateBucketAccess(context.Background(), "bucket", "user")
+				require.NoError(t, err)
+			}
+
+			err := client.DeleteBucketAccess(context.Background(), "bucket", "user")
+			assert.NoError(t, err)
+
+			iam.mu.Lock()
+			defer iam.mu.Unlock()
+			assert.Empty(t, iam.users)
+		})
+	}
+}
+
+func TestClient_DeleteBucketAccess_Error(t *testing.T) {
+	t.Parallel()
+
+	iam, srv := newFakeIAM(t)
+	client := newTestClient(t, srv.URL)
+
+	_, err := client.CreateBucketAccess(context.Background(), "bucket", "user")
+	require.NoError(t, err)
+
+	iam.fail["DeleteUser"] = "DeleteConflict"
+	err = client.DeleteBucketAccess(context.Background(), "bucket", "user")
+	assert.ErrorContains(t, err, "DeleteConflict")
+}
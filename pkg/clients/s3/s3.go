@@ -13,33 +13,45 @@
 // limitations under the License.
 
 // Package s3 provides an S3 client implementation to interact with object storage systems.
-// It leverages the MinIO Go SDK to manage buckets and access credentials.
+// It leverages the MinIO Go SDK to manage buckets and an IAM-compatible endpoint to manage access credentials.
 // This package includes support for bucket creation, deletion, access management, and checks for bucket existence.
 package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"maps"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/sse"
+	"github.com/minio/minio-go/v7/pkg/tags"
 
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
 )
 
 const (
-	regionKey        = "region"
-	objectLockingKey = "objectLocking"
+	regionKey         = "region"
+	objectLockingKey  = "objectLocking"
+	retentionModeKey  = "retentionMode"
+	retentionDaysKey  = "retentionDays"
+	retentionYearsKey = "retentionYears"
+	versioningKey     = "versioning"
+	encryptionKey     = "encryption"
+	kmsKeyIDKey       = "kmsKeyId"
+	forceDeleteKey    = "forceDelete"
 )
 
 // Client represents an S3 client instance.
 // It provides methods for performing operations on S3 buckets and managing user access.
 type Client struct {
-	s3         *minio.Client // MinIO client instance used for interacting with the S3-compatible API.
-	bucketUser S3Credentials // S3 credentials used for user access.
-	region     string
+	s3      *minio.Client // MinIO client instance used for interacting with the S3-compatible API.
+	locator *minio.Client // MinIO client without a preset region, used to look up bucket locations.
+	iam     *iamClient    // IAM client used for managing per-access users and policies.
+	admin   *adminClient  // MinIO admin client used for managing bucket quotas, nil when quotas are disabled.
+	region  string
 }
 
 // Verify that Client implements the clients.Client interface.
@@ -55,6 +67,8 @@ type S3Credentials struct {
 type user struct {
 	S3Credentials        // Embedded S3 credentials for the user.
 	name          string // The name of the user.
+	encryption    string // Default encryption enforced on the bucket, SSE-S3 or SSE-KMS, empty when not configured.
+	kmsKeyID      string // KMS key of the SSE-KMS encryption, empty for the default key.
 }
 
 // Verify that user implements the clients.User interface.
@@ -66,11 +80,20 @@ func (u *user) Name() string {
 }
 
 // Credentials returns a map of the user's S3 access credentials.
+// As the COSI S3 protocol has no field for it, the default encryption enforced on the bucket is reported
+// along with the credentials.
 func (u *user) Credentials() map[string]string {
-	return map[string]string{
+	creds := map[string]string{
 		"accessKeyId":     u.AccessKeyID,
 		"accessSecretKey": u.AccessSecretKey,
 	}
+	if u.encryption != "" {
+		creds[encryptionKey] = u.encryption
+	}
+	if u.kmsKeyID != "" {
+		creds[kmsKeyIDKey] = u.kmsKeyID
+	}
+	return creds
 }
 
 // Platform returns the name of the platform associated with the user.
@@ -79,7 +102,15 @@ func (u *user) Platform() string {
 }
 
 // New creates a new S3 Client instance.
-func New(endpoint, region string, admin S3Credentials, user S3Credentials, ssl bool) (*Client, error) {
+// Users granted access to buckets are managed through the IAM-compatible API served at iamEndpoint.
+// It is required, as MinIO and most other S3 services do not serve the IAM API at the S3 endpoint.
+// When quotas is true, bucket quotas are managed through the MinIO admin API served at the S3 endpoint.
+// Otherwise, the quota parameter is rejected, as S3 services other than MinIO do not serve the admin API.
+func New(endpoint, region string, admin S3Credentials, iamEndpoint string, ssl, quotas bool) (*Client, error) {
+	if iamEndpoint == "" {
+		return nil, errors.New("an IAM endpoint is required to manage bucket accesses")
+	}
+
 	c, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(admin.AccessKeyID, admin.AccessSecretKey, ""),
 		Region: region,
@@ -89,61 +120,297 @@ func New(endpoint, region string, admin S3Credentials, user S3Credentials, ssl b
 		return nil, fmt.Errorf("unable to create S3 client: %w", err)
 	}
 
-	return &Client{
-		s3:         c,
-		bucketUser: user,
-		region:     region,
-	}, nil
+	// A client with a preset region never asks the service for bucket locations.
+	locator, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(admin.AccessKeyID, admin.AccessSecretKey, ""),
+		Secure: ssl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create S3 client: %w", err)
+	}
+
+	client := &Client{
+		s3:      c,
+		locator: locator,
+		iam:     newIAMClient(iamEndpoint, admin, ssl),
+		region:  region,
+	}
+	if quotas {
+		client.admin = newAdminClient(endpoint, region, admin, ssl)
+	}
+
+	return client, nil
 }
 
 // BucketExists checks if a bucket exists in the S3 service.
 func (c *Client) BucketExists(ctx context.Context, bucket string) (bool, error) {
-	return c.s3.BucketExists(ctx, bucket)
+	exists, err := c.s3.BucketExists(ctx, bucket)
+	return exists, wrapError(err)
 }
 
 // IsBucketEqual checks if existing bucket has expected parameters.
-func (c *Client) IsBucketEqual(_ context.Context, _ string, _ map[string]string) (bool, error) {
-	// no-op
-	return true, nil
+// The bucket location, object lock configuration and default retention, versioning, encryption, lifecycle rules
+// and tags are read back and compared with the configuration CreateBucket would produce. Tags of the bucket
+// missing from the parameters, such as the static tags of the driver, are ignored. The quota is read back
+// when quotas are enabled, so that a bucket whose quota is not set by the parameters does not match.
+// Unknown parameters are treated as a mismatch. It fails with clients.ErrBucketAlreadyExists if the region
+// or object locking differs, as they cannot be changed on an existing bucket.
+func (c *Client) IsBucketEqual(ctx context.Context, bucket string, params map[string]string) (bool, error) {
+	for k := range params {
+		if _, ok := schema.Lookup(k); !ok {
+			return false, nil
+		}
+	}
+
+	expected, err := parseParams(params)
+	if err != nil {
+		return false, nil
+	}
+	if expected.Region == "" {
+		expected.Region = c.region
+	}
+
+	actual, err := c.readConfig(ctx, bucket)
+	if err != nil {
+		return false, wrapError(err)
+	}
+	if c.admin != nil {
+		actual.Quota, err = c.admin.getBucketQuota(ctx, bucket)
+		if err != nil {
+			return false, fmt.Errorf("unable to get bucket quota: %w", err)
+		}
+	}
+
+	if err := schema.CheckImmutable(expected.immutableParams(), actual.immutableParams()); err != nil {
+		return false, err
+	}
+	return expected.matches(actual), nil
 }
 
 // CreateBucket creates a new bucket in the S3 service.
+// If the bucket cannot be configured after its creation, e.g. its versioning cannot be set, it is removed.
+// It fails with clients.ErrInvalidParameters if the parameters cannot be parsed, and with
+// clients.ErrBucketAlreadyExists if the name is already taken, by this or another account.
 func (c *Client) CreateBucket(ctx context.Context, bucket string, params map[string]string) error {
-	var err error
-	objectLocking := false
-	ol, found := params[objectLockingKey]
-	if found && ol != "" {
-		objectLocking, err = strconv.ParseBool(ol)
+	cfg, err := parseParams(params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", clients.ErrInvalidParameters, err)
+	}
+	if cfg.Quota > 0 && c.admin == nil {
+		return fmt.Errorf("%w: %s requires the MinIO admin API, which is disabled",
+			clients.ErrInvalidParameters, clients.QuotaKey)
+	}
+
+	if err := c.s3.MakeBucket(ctx, bucket, minio.MakeBucketOptions{
+		Region:        cfg.Region,
+		ObjectLocking: cfg.ObjectLocking,
+	}); err != nil {
+		return wrapError(err)
+	}
+
+	if err := c.configure(ctx, bucket, cfg); err != nil {
+		// Remove the bucket, so that it is created again with its whole configuration on retry.
+		_ = c.s3.RemoveBucket(ctx, bucket) //nolint:errcheck // best effort cleanup
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// configure applies the configuration of a new bucket not set by MakeBucket.
+func (c *Client) configure(ctx context.Context, bucket string, cfg bucketConfig) error {
+	if cfg.RetentionMode != "" {
+		mode, validity, unit := minio.RetentionMode(cfg.RetentionMode), cfg.RetentionDays, minio.Days
+		if cfg.RetentionYears > 0 {
+			validity, unit = cfg.RetentionYears, minio.Years
+		}
+		if err := c.s3.SetObjectLockConfig(ctx, bucket, &mode, &validity, &unit); err != nil {
+			return fmt.Errorf("unable to set default retention: %w", err)
+		}
+	}
+
+	switch cfg.Encryption {
+	case sseS3Algorithm:
+		if err := c.s3.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSES3()); err != nil {
+			return fmt.Errorf("unable to set bucket encryption: %w", err)
+		}
+	case sseKMSAlgorithm:
+		if err := c.s3.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSEKMS(cfg.KMSKeyID)); err != nil {
+			return fmt.Errorf("unable to set bucket encryption: %w", err)
+		}
+	}
+
+	// Object locking enables versioning, which cannot be suspended afterwards.
+	if cfg.Versioning != "" && !cfg.ObjectLocking {
+		if err := c.s3.SetBucketVersioning(ctx, bucket, minio.BucketVersioningConfiguration{
+			Status: cfg.Versioning,
+		}); err != nil {
+			return fmt.Errorf("unable to set bucket versioning: %w", err)
+		}
+	}
+
+	if !cfg.Lifecycle.IsZero() {
+		if err := c.s3.SetBucketLifecycle(ctx, bucket, lifecycleConfig(cfg.Lifecycle)); err != nil {
+			return fmt.Errorf("unable to set bucket lifecycle: %w", err)
+		}
+	}
+
+	if cfg.Quota > 0 {
+		if err := c.admin.setBucketQuota(ctx, bucket, cfg.Quota); err != nil {
+			return fmt.Errorf("unable to set bucket quota: %w", err)
+		}
+	}
+
+	bucketTags := maps.Clone(cfg.Tags)
+	if cfg.ForceDelete {
+		if bucketTags == nil {
+			bucketTags = map[string]string{}
+		}
+		bucketTags[forceDeleteTag] = "true"
+	}
+	if len(bucketTags) > 0 {
+		t, err := tags.MapToBucketTags(bucketTags)
 		if err != nil {
-			return err
+			return fmt.Errorf("unable to build bucket tags: %w", err)
+		}
+		if err := c.s3.SetBucketTagging(ctx, bucket, t); err != nil {
+			return fmt.Errorf("unable to set bucket tags: %w", err)
 		}
 	}
 
-	return c.s3.MakeBucket(ctx, bucket, minio.MakeBucketOptions{
-		Region:        params[regionKey],
-		ObjectLocking: objectLocking,
-	})
+	return nil
 }
 
 // DeleteBucket deletes a bucket from the S3 service.
+// A bucket still holding objects is only deleted if it was created with the forceDelete parameter,
+// in which case its objects and object versions are removed first. Otherwise, or if object lock
+// protects some versions, it fails with clients.ErrBucketNotEmpty.
+// It fails with clients.ErrBucketNotFound if the bucket does not exist.
 func (c *Client) DeleteBucket(ctx context.Context, bucket string) error {
-	return c.s3.RemoveBucket(ctx, bucket)
+	err := c.s3.RemoveBucket(ctx, bucket)
+	if !isErrorCode(err, "BucketNotEmpty") {
+		return wrapError(err)
+	}
+
+	force, err := c.forceDelete(ctx, bucket)
+	if err != nil {
+		return wrapError(err)
+	}
+	if !force {
+		return fmt.Errorf("%w: %s", clients.ErrBucketNotEmpty, bucket)
+	}
+
+	if err := c.drain(ctx, bucket); err != nil {
+		return wrapError(err)
+	}
+
+	return wrapError(c.s3.RemoveBucket(ctx, bucket))
 }
 
-// CreateBucketAccess creates access credentials for a bucket.
-func (c *Client) CreateBucketAccess(_ context.Context, bucket, userID string) (clients.User, error) {
+// CreateBucketAccess creates a dedicated user with a policy scoped to the bucket and returns its credentials.
+// If the user already exists, its previous access keys are replaced with a new one. If the access cannot be
+// granted, a user created by the call is removed along with its policy and keys.
+// It fails with clients.ErrBucketNotFound if the bucket does not exist.
+func (c *Client) CreateBucketAccess(ctx context.Context, bucket, userID string) (clients.User, error) {
+	policy, err := bucketPolicy(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build bucket policy: %w", err)
+	}
+
+	encryption, kmsKeyID, err := c.encryption(ctx, bucket)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	created := true
+	if err := c.iam.createUser(ctx, userID); err != nil {
+		if !isIAMError(err, iamEntityAlreadyExists) {
+			return nil, fmt.Errorf("unable to create user: %w", err)
+		}
+		created = false
+	}
+
+	creds, err := c.grantUser(ctx, bucket, userID, policy)
+	if err != nil {
+		if created {
+			// IAM refuses to delete users that still have policies or keys, so they are removed first.
+			if cleanupErr := c.DeleteBucketAccess(ctx, bucket, userID); cleanupErr != nil {
+				err = errors.Join(err, fmt.Errorf("unable to remove user %s: %w", userID, cleanupErr))
+			}
+		}
+		return nil, err
+	}
+
 	return &user{
-		S3Credentials: c.bucketUser,
+		S3Credentials: creds,
 		name:          userID,
+		encryption:    encryption,
+		kmsKeyID:      kmsKeyID,
 	}, nil
 }
 
-// DeleteBucketAccess removes access credentials for a bucket.
-func (c *Client) DeleteBucketAccess(_ context.Context, _, _ string) error {
-	// no-op
+// grantUser attaches the bucket policy to the user and issues a fresh access key.
+func (c *Client) grantUser(ctx context.Context, bucket, userID, policy string) (S3Credentials, error) {
+	if err := c.iam.putUserPolicy(ctx, userID, policyName(bucket), policy); err != nil {
+		return S3Credentials{}, fmt.Errorf("unable to attach policy: %w", err)
+	}
+
+	if err := c.deleteAccessKeys(ctx, userID); err != nil {
+		return S3Credentials{}, err
+	}
+
+	creds, err := c.iam.createAccessKey(ctx, userID)
+	if err != nil {
+		return S3Credentials{}, fmt.Errorf("unable to create access key: %w", err)
+	}
+
+	return creds, nil
+}
+
+// DeleteBucketAccess removes the user created for the bucket access together with its policy and keys.
+// Missing users, policies or keys are not treated as errors.
+func (c *Client) DeleteBucketAccess(ctx context.Context, bucket, userID string) error {
+	if err := c.iam.deleteUserPolicy(ctx, userID, policyName(bucket)); err != nil && !isIAMError(err, iamNoSuchEntity) {
+		return fmt.Errorf("unable to delete policy: %w", err)
+	}
+
+	if err := c.deleteAccessKeys(ctx, userID); err != nil && !isIAMError(err, iamNoSuchEntity) {
+		return err
+	}
+
+	if err := c.iam.deleteUser(ctx, userID); err != nil && !isIAMError(err, iamNoSuchEntity) {
+		return fmt.Errorf("unable to delete user: %w", err)
+	}
+
 	return nil
 }
 
+// deleteAccessKeys removes all access keys of the user.
+func (c *Client) deleteAccessKeys(ctx context.Context, userID string) error {
+	keys, err := c.iam.listAccessKeys(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("unable to list access keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if err := c.iam.deleteAccessKey(ctx, userID, key); err != nil && !isIAMError(err, iamNoSuchEntity) {
+			return fmt.Errorf("unable to delete access key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ParameterSchema returns the BucketClass parameters supported by CreateBucket.
+func (c *Client) ParameterSchema() clients.Schema {
+	return schema
+}
+
+// NameRules returns the naming rules of S3 buckets.
+func (c *Client) NameRules() clients.NameRules {
+	return clients.S3NameRules
+}
+
 // Protocol returns detailed information about protocol supported by the storage backend.
 func (c *Client) ProtocolInfo() *cosi.Protocol {
 	return &cosi.Protocol{
@@ -49,6 +49,8 @@ Example configuration (https://min.io/docs/minio/linux/administration/minio-cons
 	export TEST_S3_SSL="true"
 	export TEST_S3_ACCESS_KEY_ID="Q3AM3UQ867SPQQA43P2F"
 	export TEST_S3_ACCESS_SECRET_KEY="zuf+tfteSlswRu7BJ86wekitnifILbZam1KYY3TG"
+	export TEST_S3_IAM_ENDPOINT="iam.amazonaws.com" # IAM-compatible endpoint, MinIO does not serve the IAM API
+	export TEST_S3_QUOTAS="false"  # optional, requires MinIO admin credentials
 */
 
 func bucketName(prefix string) string {
@@ -65,6 +67,8 @@ var (
 	testSSL             = requiredEnv("TEST_S3_SSL").Bool()
 	testAccessKeyID     = requiredEnv("TEST_S3_ACCESS_KEY_ID").String()
 	testAccessSecretKey = requiredEnv("TEST_S3_ACCESS_SECRET_KEY").String()
+	testIAMEndpoint     = requiredEnv("TEST_S3_IAM_ENDPOINT").String()
+	testQuotas          = env(os.Getenv("TEST_S3_QUOTAS")).Bool()
 
 	testCreds = S3Credentials{
 		AccessKeyID:     testAccessKeyID,
@@ -75,7 +79,7 @@ var (
 func TestClient_New(t *testing.T) {
 	t.Parallel()
 
-	client, err := New(testEndpoint, testRegion, testCreds, testCreds, testSSL)
+	client, err := New(testEndpoint, testRegion, testCreds, testIAMEndpoint, testSSL, testQuotas)
 	assert.NoError(t, err)
 	assert.NotNil(t, client)
 }
@@ -100,7 +104,7 @@ func TestClient_CreateBucket(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			client, err := New(testEndpoint, testRegion, testCreds, testCreds, testSSL)
+			client, err := New(testEndpoint, testRegion, testCreds, testIAMEndpoint, testSSL, testQuotas)
 			require.NoError(t, err)
 			defer client.DeleteBucket(context.Background(), tc.bucketName) //nolint:errcheck // best effort call
 
@@ -124,7 +128,7 @@ func TestClient_BucketExists(t *testing.T) {
 	existing := bucketName("exists")
 	nonexisting := bucketName("not-exists")
 
-	client, err := New(testEndpoint, testRegion, testCreds, testCreds, testSSL)
+	client, err := New(testEndpoint, testRegion, testCreds, testIAMEndpoint, testSSL, testQuotas)
 	require.NoError(t, err)
 	defer client.DeleteBucket(context.Background(), existing) //nolint:errcheck // best effort call
 
@@ -164,7 +168,7 @@ func TestClient_CreateBucketAccess(t *testing.T) {
 
 	bucket := bucketName("access")
 
-	client, err := New(testEndpoint, testRegion, testCreds, testCreds, testSSL)
+	client, err := New(testEndpoint, testRegion, testCreds, testIAMEndpoint, testSSL, testQuotas)
 	require.NoError(t, err)
 	defer client.DeleteBucket(context.Background(), bucket) //nolint:errcheck // best effort call
 
@@ -172,19 +176,20 @@ func TestClient_CreateBucketAccess(t *testing.T) {
 	require.NoError(t, err)
 
 	user, err := client.CreateBucketAccess(context.Background(), bucket, "test-user")
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	defer client.DeleteBucketAccess(context.Background(), bucket, "test-user") //nolint:errcheck // best effort call
+
 	assert.Equal(t, "test-user", user.Name())
 	assert.Equal(t, "s3", user.Platform())
-	assert.Equal(t, map[string]string{
-		"accessKeyId":     testAccessKeyID,
-		"accessSecretKey": testAccessSecretKey,
-	}, user.Credentials())
+	assert.NotEmpty(t, user.Credentials()["accessKeyId"])
+	assert.NotEmpty(t, user.Credentials()["accessSecretKey"])
+	assert.NotEqual(t, testAccessKeyID, user.Credentials()["accessKeyId"])
 }
 
 func TestClient_ProtocolInfo(t *testing.T) {
 	t.Parallel()
 
-	client, err := New(testEndpoint, testRegion, testCreds, testCreds, testSSL)
+	client, err := New(testEndpoint, testRegion, testCreds, testIAMEndpoint, testSSL, testQuotas)
 	require.NoError(t, err)
 
 	protocol := client.ProtocolInfo()
@@ -0,0 +1,150 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParameterType is the type of the value of a BucketClass parameter.
+type ParameterType string
+
+const (
+	String   ParameterType = "string"   // Any string.
+	Bool     ParameterType = "bool"     // A boolean, as accepted by strconv.ParseBool.
+	Int      ParameterType = "int"      // An integer, as accepted by strconv.Atoi.
+	Quantity ParameterType = "quantity" // A quantity of bytes, as accepted by ParseQuantity.
+)
+
+// Parameter describes a BucketClass parameter supported by a client.
+type Parameter struct {
+	Name    string        // Key of the parameter in the BucketClass.
+	Type    ParameterType // Type of the value.
+	Allowed []string      // Allowed values, any value of the type is accepted when empty.
+	Default string        // Value used by the backend when the parameter is not set.
+	Mutable bool          // Whether the setting can be changed on an existing bucket without recreating it.
+}
+
+// Schema is the set of BucketClass parameters supported by a client.
+// A nil Schema accepts any parameters.
+type Schema []Parameter
+
+// Lookup returns the parameter with the given name.
+func (s Schema) Lookup(name string) (Parameter, bool) {
+	for _, p := range s {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// Keys returns the sorted names of the parameters.
+func (s Schema) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for _, p := range s {
+		keys = append(keys, p.Name)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Validate checks that params only holds parameters of the schema, with values of the right type.
+// Empty values stand for the default and are always valid.
+// The returned error wraps ErrInvalidParameters and reports the first invalid parameter by name.
+func (s Schema) Validate(params map[string]string) error {
+	if s == nil {
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		p, ok := s.Lookup(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown parameter %q, valid parameters are: %s",
+				ErrInvalidParameters, name, strings.Join(s.describe(), ", "))
+		}
+		if err := p.validate(params[name]); err != nil {
+			return fmt.Errorf("%w: invalid value %q for parameter %q: %w", ErrInvalidParameters, params[name], name, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckImmutable fails with ErrBucketAlreadyExists if an immutable parameter set in expected has a different
+// value in actual, compared case-insensitively. Both hold parameter values by name, as found in a BucketClass,
+// and parameters missing from actual stand for their default.
+// Such a difference cannot be reconciled without recreating the bucket.
+func (s Schema) CheckImmutable(expected, actual map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(expected)) {
+		p, ok := s.Lookup(name)
+		if !ok || p.Mutable || expected[name] == "" {
+			continue
+		}
+		if value := cmp.Or(actual[name], p.Default); !strings.EqualFold(expected[name], value) {
+			return fmt.Errorf("%w: immutable parameter %q is %q on the existing bucket, not %q",
+				ErrBucketAlreadyExists, name, value, expected[name])
+		}
+	}
+
+	return nil
+}
+
+// describe returns the sorted names of the parameters, with immutable ones marked as such.
+func (s Schema) describe() []string {
+	names := s.Keys()
+	for i, name := range names {
+		if p, _ := s.Lookup(name); !p.Mutable {
+			names[i] += " (immutable)"
+		}
+	}
+	return names
+}
+
+func (p Parameter) validate(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	switch p.Type {
+	case Bool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("must be a boolean")
+		}
+	case Int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.New("must be an integer")
+		}
+	case Quantity:
+		if _, err := ParseQuantity(value); err != nil {
+			return errors.New("must be a quantity of bytes, e.g. 10Gi")
+		}
+	case String:
+	default:
+		return fmt.Errorf("unsupported parameter type %q", p.Type)
+	}
+
+	if len(p.Allowed) > 0 && !slices.Contains(p.Allowed, value) {
+		return fmt.Errorf("must be one of: %s", strings.Join(p.Allowed, ", "))
+	}
+
+	return nil
+}
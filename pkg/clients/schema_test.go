@@ -0,0 +1,160 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		{Name: "region", Type: String},
+		{Name: "locking", Type: Bool, Default: "false"},
+		{Name: "access", Type: String, Allowed: []string{"none", "blob"}, Default: "none", Mutable: true},
+		{Name: "days", Type: Int, Mutable: true},
+		{Name: "size", Type: Quantity, Mutable: true},
+	}
+
+	tests := map[string]struct {
+		schema      Schema
+		params      map[string]string
+		expectedErr string
+	}{
+		"no parameters": {
+			schema: schema,
+		},
+		"valid parameters": {
+			schema: schema,
+			params: map[string]string{
+				"region": "eu-west-1", "locking": "true", "access": "blob", "days": "30", "size": "10Gi",
+			},
+		},
+		"empty values": {
+			schema: schema,
+			params: map[string]string{"locking": "", "access": ""},
+		},
+		"unknown parameter": {
+			schema: schema,
+			params: map[string]string{"region": "eu-west-1", "versioning": "true"},
+			expectedErr: `unknown parameter "versioning", valid parameters are: ` +
+				`access, days, locking (immutable), region (immutable), size`,
+		},
+		"invalid boolean": {
+			schema:      schema,
+			params:      map[string]string{"locking": "maybe"},
+			expectedErr: `invalid value "maybe" for parameter "locking": must be a boolean`,
+		},
+		"invalid integer": {
+			schema:      schema,
+			params:      map[string]string{"days": "30d"},
+			expectedErr: `invalid value "30d" for parameter "days": must be an integer`,
+		},
+		"invalid quantity": {
+			schema:      schema,
+			params:      map[string]string{"size": "10GB"},
+			expectedErr: `invalid value "10GB" for parameter "size": must be a quantity of bytes, e.g. 10Gi`,
+		},
+		"value not allowed": {
+			schema:      schema,
+			params:      map[string]string{"access": "everyone"},
+			expectedErr: `invalid value "everyone" for parameter "access": must be one of: none, blob`,
+		},
+		"first invalid parameter by name": {
+			schema:      schema,
+			params:      map[string]string{"locking": "maybe", "access": "everyone"},
+			expectedErr: `parameter "access"`,
+		},
+		"nil schema": {
+			params: map[string]string{"anything": "goes"},
+		},
+		"empty schema": {
+			schema:      Schema{},
+			params:      map[string]string{"anything": "goes"},
+			expectedErr: `unknown parameter "anything", valid parameters are: `,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.schema.Validate(tc.params)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidParameters)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestSchema_CheckImmutable(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		{Name: "region", Type: String},
+		{Name: "locking", Type: Bool, Default: "false"},
+		{Name: "days", Type: Int, Mutable: true},
+	}
+
+	tests := map[string]struct {
+		expected    map[string]string
+		actual      map[string]string
+		expectedErr string
+	}{
+		"no parameters": {
+			actual: map[string]string{"region": "eu-west-1"},
+		},
+		"same values": {
+			expected: map[string]string{"region": "eu-west-1", "locking": "true"},
+			actual:   map[string]string{"region": "EU-WEST-1", "locking": "true"},
+		},
+		"mutable parameter changed": {
+			expected: map[string]string{"region": "eu-west-1", "days": "30"},
+			actual:   map[string]string{"region": "eu-west-1", "days": "7"},
+		},
+		"default value": {
+			expected: map[string]string{"locking": "false"},
+		},
+		"unset and unknown parameters": {
+			expected: map[string]string{"region": "", "anything": "goes"},
+			actual:   map[string]string{"region": "eu-west-1"},
+		},
+		"immutable parameter changed": {
+			expected:    map[string]string{"region": "eu-west-1", "locking": "true"},
+			actual:      map[string]string{"region": "us-east-1", "locking": "false"},
+			expectedErr: `immutable parameter "locking" is "false" on the existing bucket, not "true"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := schema.CheckImmutable(tc.expected, tc.actual)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrBucketAlreadyExists)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// TagsKey is the BucketClass parameter holding the tags of a bucket, for clients supporting tags.
+// Its value is a comma separated list of key=value pairs, e.g. "team=storage,env=prod".
+const TagsKey = "tags"
+
+// ParseTags parses a comma separated list of key=value pairs.
+// Spaces around keys and values are trimmed, and empty entries are ignored.
+// It fails if an entry has no key, or if a key is repeated.
+func ParseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for entry := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(entry, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q: must be key=value", strings.TrimSpace(entry))
+		}
+		if _, ok := tags[key]; ok {
+			return nil, fmt.Errorf("duplicate tag %q", key)
+		}
+		tags[key] = value
+	}
+
+	return tags, nil
+}
+
+// HasTags reports whether tags holds all the expected tags with the same values.
+// Other tags are ignored, as buckets may carry tags that were not set from the BucketClass,
+// such as the static tags of the driver configuration.
+func HasTags(tags, expected map[string]string) bool {
+	for key, value := range expected {
+		if actual, ok := tags[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatTags formats tags as a comma separated list of key=value pairs sorted by key, as parsed by ParseTags.
+func FormatTags(tags map[string]string) string {
+	entries := make([]string, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		entries = append(entries, key+"="+tags[key])
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value       string
+		expected    map[string]string
+		expectedErr string
+	}{
+		"empty": {
+			expected: map[string]string{},
+		},
+		"tags": {
+			value:    "team=storage,env=prod",
+			expected: map[string]string{"team": "storage", "env": "prod"},
+		},
+		"spaces and empty entries": {
+			value:    " team = storage , ,cost center=1234,",
+			expected: map[string]string{"team": "storage", "cost center": "1234"},
+		},
+		"empty value": {
+			value:    "team=",
+			expected: map[string]string{"team": ""},
+		},
+		"value with separator": {
+			value:    "query=a=b",
+			expected: map[string]string{"query": "a=b"},
+		},
+		"missing separator": {
+			value:       "team=storage,env",
+			expectedErr: `invalid tag "env": must be key=value`,
+		},
+		"missing key": {
+			value:       "=storage",
+			expectedErr: `invalid tag "=storage": must be key=value`,
+		},
+		"duplicate key": {
+			value:       "team=a, team=b",
+			expectedErr: `duplicate tag "team"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tags, err := ParseTags(tc.value)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tags)
+
+			// formatted tags are parsed back to the same tags
+			parsed, err := ParseTags(FormatTags(tags))
+			require.NoError(t, err)
+			assert.Equal(t, tags, parsed)
+		})
+	}
+}
+
+func TestHasTags(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"cluster": "prod", "team": "storage"}
+
+	assert.True(t, HasTags(tags, nil))
+	assert.True(t, HasTags(tags, map[string]string{"team": "storage"}))
+	assert.True(t, HasTags(tags, tags))
+	assert.False(t, HasTags(tags, map[string]string{"team": "finance"}))
+	assert.False(t, HasTags(tags, map[string]string{"team": "storage", "env": "prod"}))
+	assert.False(t, HasTags(nil, map[string]string{"env": ""}))
+}
+
+func TestFormatTags(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, FormatTags(nil))
+	assert.Equal(t, "a=1,b=,c=3", FormatTags(map[string]string{"c": "3", "a": "1", "b": ""}))
+}
@@ -24,7 +24,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
 
 	"google.golang.org/grpc/codes"
 
@@ -34,9 +41,14 @@ import (
 // Config represents the root configuration for customizing the behavior of the driver.
 // It includes options for mocking calls, overriding specific responses, and injecting errors.
 type Config struct {
-	Mode      Mode      `yaml:"mode"`      // Indicates if the driver should run in Impl/Fake Azure/S3 mode.
+	Mode      Mode      `yaml:"mode"`      // Indicates if the driver should run in Impl/Fake Azure/GCS/S3 mode.
 	Overrides Overrides `yaml:"overrides"` // Specifies overrides for bucket and credential information.
+	Naming    Naming    `yaml:"naming"`    // Defines how bucket names are generated.
+	Tags      Tags      `yaml:"tags"`      // Static tags of new buckets, for backends supporting tags.
 	Errors    Errors    `yaml:"errors"`    // Defines errors to be injected into specific driver calls.
+	Delays    Delays    `yaml:"delays"`    // Defines delays to be injected into specific driver calls.
+	Fake      Fake      `yaml:"fake"`      // Configures the fake storage backends.
+	Local     Local     `yaml:"local"`     // Configures the local storage backend.
 }
 
 // Mode represents the storage backend mode.
@@ -45,8 +57,11 @@ type Mode string
 const (
 	ModeAzure     = Mode("azure:impl") // ModeAzure represents the Azure Blob storage mode.
 	ModeAzureFake = Mode("azure:fake") // ModeAzure represents the Azure Blob storage mode.
+	ModeGCS       = Mode("gcs:impl")   // ModeGCS represents the Google Cloud Storage mode.
+	ModeGCSFake   = Mode("gcs:fake")   // ModeGCSFake represents a fake Google Cloud Storage mode.
 	ModeS3        = Mode("s3:impl")    // ModeS3 represents the Amazon S3 storage mode.
 	ModeS3Fake    = Mode("s3:fake")    // ModeFake represents a fake storage mode.
+	ModeS3Local   = Mode("s3:local")   // ModeS3Local represents the local filesystem storage mode.
 )
 
 // UnmarshalYAML custom unmarshaller for Mode.
@@ -57,7 +72,7 @@ func (m *Mode) UnmarshalYAML(value *yaml.Node) error {
 	}
 
 	switch Mode(modeStr) {
-	case ModeAzure, ModeAzureFake, ModeS3, ModeS3Fake:
+	case ModeAzure, ModeAzureFake, ModeGCS, ModeGCSFake, ModeS3, ModeS3Fake, ModeS3Local:
 		*m = Mode(modeStr)
 		return nil
 	default:
@@ -68,6 +83,7 @@ func (m *Mode) UnmarshalYAML(value *yaml.Node) error {
 // Errors defines the structure for injecting errors into specific COSI driver calls.
 // Each field corresponds to a driver call where a custom error can be specified.
 type Errors struct {
+	Seed               *int64       `yaml:"seed,omitempty"`               // Seed for probabilistic errors and delays.
 	GetInfo            *StatusError `yaml:"getInfo,omitempty"`            // Error for the GetInfo call.
 	CreateBucket       *StatusError `yaml:"createBucket,omitempty"`       // Error for the CreateBucket call.
 	DeleteBucket       *StatusError `yaml:"deleteBucket,omitempty"`       // Error for the DeleteBucket call.
@@ -75,17 +91,278 @@ type Errors struct {
 	RevokeBucketAccess *StatusError `yaml:"revokeBucketAccess,omitempty"` // Error for the RevokeBucketAccess call.
 }
 
+// UnmarshalYAML custom unmarshaller for Errors, rejecting parameter matches on calls without parameters.
+// Only CreateBucket and GrantBucketAccess receive parameters, so a rule matching parameters on other calls
+// would never fire.
+func (e *Errors) UnmarshalYAML(value *yaml.Node) error {
+	type plain Errors
+	if err := value.Decode((*plain)(e)); err != nil {
+		return err
+	}
+
+	for _, rule := range []struct {
+		call string
+		err  *StatusError
+	}{
+		{"getInfo", e.GetInfo},
+		{"deleteBucket", e.DeleteBucket},
+		{"revokeBucketAccess", e.RevokeBucketAccess},
+	} {
+		if rule.err != nil && rule.err.Match != nil && len(rule.err.Match.Parameters) > 0 {
+			return fmt.Errorf("%s cannot match parameters, as the call has none", rule.call)
+		}
+	}
+
+	return nil
+}
+
 // StatusError represents an error that can be injected into driver calls.
-// It includes a message and a gRPC error code.
+// It includes a message and a gRPC error code, and optional rules restricting
+// which calls fail. Without rules, every call fails.
 type StatusError struct {
-	Message string     `yaml:"message"` // Human-readable description of the error.
-	Code    codes.Code `yaml:"code"`    // gRPC status code for the error (e.g., codes.InvalidArgument).
+	Message     string     `yaml:"message"`               // Human-readable description of the error.
+	Code        codes.Code `yaml:"code"`                  // gRPC status code for the error (e.g., codes.InvalidArgument).
+	Probability *float64   `yaml:"probability,omitempty"` // Probability of failing a call, between 0 and 1.
+	FailFirst   int        `yaml:"failFirst,omitempty"`   // Fail only the first N matching calls, then succeed.
+	Every       int        `yaml:"every,omitempty"`       // Fail only every Nth matching call.
+	Match       *Match     `yaml:"match,omitempty"`       // Restricts the error to matching calls.
 }
 
 func (err *StatusError) Error() string {
 	return fmt.Sprintf("%s (code %d)", err.Message, err.Code)
 }
 
+// UnmarshalYAML custom unmarshaller for StatusError, validating the injection rules.
+func (err *StatusError) UnmarshalYAML(value *yaml.Node) error {
+	type plain StatusError
+	if decodeErr := value.Decode((*plain)(err)); decodeErr != nil {
+		return decodeErr
+	}
+
+	if p := err.Probability; p != nil && (*p < 0 || *p > 1) {
+		return fmt.Errorf("probability must be between 0 and 1, got %v", *p)
+	}
+	if err.FailFirst < 0 {
+		return fmt.Errorf("failFirst must not be negative, got %d", err.FailFirst)
+	}
+	if err.Every < 0 {
+		return fmt.Errorf("every must not be negative, got %d", err.Every)
+	}
+	if m := err.Match; m != nil && m.BucketName != "" {
+		if _, matchErr := path.Match(m.BucketName, ""); matchErr != nil {
+			return fmt.Errorf("invalid bucketName pattern %q: %w", m.BucketName, matchErr)
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether a call for the given bucket and parameters is subject to the error.
+// Calls without a bucket name (e.g. GetInfo) only match rules without a bucketName pattern.
+func (err *StatusError) Matches(bucket string, parameters map[string]string) bool {
+	if err.Match == nil {
+		return true
+	}
+
+	if pattern := err.Match.BucketName; pattern != "" {
+		if ok, _ := path.Match(pattern, bucket); !ok {
+			return false
+		}
+	}
+
+	for k, v := range err.Match.Parameters {
+		if actual, ok := parameters[k]; !ok || actual != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match restricts an injected error to calls for specific buckets or BucketClass parameters.
+// Parameters can only be matched on the CreateBucket and GrantBucketAccess calls, as other calls have none.
+type Match struct {
+	BucketName string            `yaml:"bucketName,omitempty"` // Glob pattern the bucket name must match.
+	Parameters map[string]string `yaml:"parameters,omitempty"` // Parameters that must be present with the given values.
+}
+
+// Delays defines the structure for injecting latency into specific COSI driver calls.
+// Each field corresponds to a driver call where a delay can be specified.
+type Delays struct {
+	GetInfo            *Delay `yaml:"getInfo,omitempty"`            // Delay for the GetInfo call.
+	CreateBucket       *Delay `yaml:"createBucket,omitempty"`       // Delay for the CreateBucket call.
+	DeleteBucket       *Delay `yaml:"deleteBucket,omitempty"`       // Delay for the DeleteBucket call.
+	GrantBucketAccess  *Delay `yaml:"grantBucketAccess,omitempty"`  // Delay for the GrantBucketAccess call.
+	RevokeBucketAccess *Delay `yaml:"revokeBucketAccess,omitempty"` // Delay for the RevokeBucketAccess call.
+}
+
+// Delay represents latency injected into a driver call before it is handled.
+// It is either a fixed duration, a random duration in the [min, max] range,
+// or a hang lasting until the deadline of the call is exceeded.
+type Delay struct {
+	Duration time.Duration `yaml:"duration,omitempty"` // Fixed delay, e.g. "2s".
+	Min      time.Duration `yaml:"min,omitempty"`      // Lower bound of a random delay.
+	Max      time.Duration `yaml:"max,omitempty"`      // Upper bound of a random delay.
+	Hang     bool          `yaml:"hang,omitempty"`     // Block until the call's context is done.
+}
+
+// UnmarshalYAML custom unmarshaller for Delay, validating the delay is unambiguous.
+func (d *Delay) UnmarshalYAML(value *yaml.Node) error {
+	type plain Delay
+	if err := value.Decode((*plain)(d)); err != nil {
+		return err
+	}
+
+	if d.Duration < 0 || d.Min < 0 || d.Max < 0 {
+		return errors.New("delay must not be negative")
+	}
+	if d.Min > 0 && d.Max == 0 {
+		return errors.New("max is required when min is set")
+	}
+	if d.Min > d.Max {
+		return fmt.Errorf("min (%s) must not be greater than max (%s)", d.Min, d.Max)
+	}
+
+	kinds := 0
+	for _, set := range []bool{d.Duration > 0, d.Max > 0, d.Hang} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return errors.New("only one of duration, min/max and hang can be set")
+	}
+
+	return nil
+}
+
+// Fake configures the storage used by the fake modes.
+type Fake struct {
+	// StatePath is the file buckets and accesses are persisted to, so they survive driver restarts.
+	// The state is kept in memory only when empty.
+	StatePath string `yaml:"statePath,omitempty"`
+
+	// Server configures the embedded storage server backed by the fake buckets.
+	Server FakeServer `yaml:"server,omitempty"`
+}
+
+// FakeServer configures the embedded storage server of the fake modes, available in s3:fake and azure:fake modes.
+type FakeServer struct {
+	Address  string `yaml:"address,omitempty"`  // Listen address, e.g. ":9000". The server is disabled when empty.
+	Endpoint string `yaml:"endpoint,omitempty"` // URL returned to workloads, "http://" + Address if empty.
+}
+
+// Local configures the storage used by the local mode.
+type Local struct {
+	// Root is the directory buckets are stored in, one subdirectory per bucket.
+	// The parameters and accesses of the buckets are persisted in its .cosi subdirectory.
+	Root string `yaml:"root,omitempty"`
+}
+
+const (
+	// DefaultNameTemplate is the template of bucket names when none is configured.
+	DefaultNameTemplate = "{{.Prefix}}{{.Name}}"
+
+	// DefaultHashLength is the length of the hash of bucket names when none is configured.
+	DefaultHashLength = 8
+)
+
+// Naming defines how the names of new buckets are generated from the names requested by the sidecar.
+// The generated names are sanitized and truncated to follow the naming rules of the backend.
+type Naming struct {
+	// Template is a text/template of bucket names, executed with NameData. DefaultNameTemplate if empty.
+	Template   string `yaml:"template,omitempty"`
+	Prefix     string `yaml:"prefix,omitempty"`     // Prefix of bucket names, available as {{.Prefix}}.
+	ClusterID  string `yaml:"clusterID,omitempty"`  // Identifier of the cluster, available as {{.ClusterID}}.
+	HashLength int    `yaml:"hashLength,omitempty"` // Length of {{.Hash}}, up to 64. DefaultHashLength if zero.
+}
+
+// NameData is the data the naming template is executed with.
+type NameData struct {
+	Prefix    string // Configured prefix.
+	ClusterID string // Configured cluster identifier.
+	Name      string // Name requested by the sidecar, possibly shortened to fit the naming rules of the backend.
+	Hash      string // Hex encoded hash of the cluster identifier and the full requested name.
+}
+
+// UnmarshalYAML custom unmarshaller for Naming, validating the template.
+func (n *Naming) UnmarshalYAML(value *yaml.Node) error {
+	type plain Naming
+	if err := value.Decode((*plain)(n)); err != nil {
+		return err
+	}
+
+	if n.HashLength < 0 || n.HashLength > sha256.Size*2 {
+		return fmt.Errorf("hashLength must be between 0 and %d, got %d", sha256.Size*2, n.HashLength)
+	}
+	if _, err := n.Execute("name", "name"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Execute executes the naming template for the name, hashing the full requested name.
+// The name may be a shortened version of the requested name.
+func (n Naming) Execute(name, requested string) (string, error) {
+	text := n.Template
+	if text == "" {
+		text = DefaultNameTemplate
+	}
+
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid naming template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, NameData{
+		Prefix:    n.Prefix,
+		ClusterID: n.ClusterID,
+		Name:      name,
+		Hash:      n.Hash(requested),
+	}); err != nil {
+		return "", fmt.Errorf("invalid naming template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+// Hash returns the hex encoded hash of the cluster identifier and the requested name, of the configured length.
+func (n Naming) Hash(requested string) string {
+	sum := sha256.Sum256([]byte(n.ClusterID + "/" + requested))
+	length := n.HashLength
+	if length == 0 {
+		length = DefaultHashLength
+	}
+	return hex.EncodeToString(sum[:])[:length]
+}
+
+// Tags are static tags applied to every new bucket, merged with the tags parameter of the BucketClass.
+// Tags of the BucketClass take precedence over static tags with the same key.
+// The namespace and name of the BucketClaim cannot be tagged, as COSI does not pass them to drivers.
+type Tags map[string]string
+
+// UnmarshalYAML custom unmarshaller for Tags, validating they can be merged with the tags parameter,
+// which is a comma separated list of key=value pairs.
+func (t *Tags) UnmarshalYAML(value *yaml.Node) error {
+	type plain Tags
+	if err := value.Decode((*plain)(t)); err != nil {
+		return err
+	}
+
+	for k, v := range *t {
+		if k == "" || k != strings.TrimSpace(k) || strings.ContainsAny(k, "=,") {
+			return fmt.Errorf("invalid tag key %q: must not be empty, have surrounding spaces, or hold '=' or ','", k)
+		}
+		if v != strings.TrimSpace(v) || strings.Contains(v, ",") {
+			return fmt.Errorf("invalid value of tag %q: must not have surrounding spaces or hold ','", k)
+		}
+	}
+
+	return nil
+}
+
 // Overrides specifies configuration overrides for the driver.
 // This includes bucket identifiers and credentials.
 type Overrides struct {
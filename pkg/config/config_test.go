@@ -16,8 +16,10 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 
 	yaml "sigs.k8s.io/yaml/goyaml.v3"
@@ -38,6 +40,13 @@ func TestUnmarshallConfig(t *testing.T) {
 			},
 			expectedError: "",
 		},
+		"valid gcs fake mode": {
+			configLiteral: `mode: gcs:fake`,
+			expectedConfig: Config{
+				Mode: ModeGCSFake,
+			},
+			expectedError: "",
+		},
 		"unsupported mode": {
 			configLiteral:  `mode: invalid:mode`,
 			expectedConfig: Config{},
@@ -67,6 +76,250 @@ errors:
 			},
 			expectedError: "",
 		},
+		"conditional errors": {
+			configLiteral: `
+mode: s3:fake
+errors:
+  seed: 42
+  createBucket:
+    message: "Flaky backend"
+    code: 14
+    probability: 0.5
+    failFirst: 3
+    every: 2
+    match:
+      bucketName: "flaky-*"
+      parameters:
+        tier: gold
+`,
+			expectedConfig: Config{
+				Mode: ModeS3Fake,
+				Errors: Errors{
+					Seed: ptr(int64(42)),
+					CreateBucket: &StatusError{
+						Message:     "Flaky backend",
+						Code:        codes.Unavailable,
+						Probability: ptr(0.5),
+						FailFirst:   3,
+						Every:       2,
+						Match: &Match{
+							BucketName: "flaky-*",
+							Parameters: map[string]string{"tier": "gold"},
+						},
+					},
+				},
+			},
+			expectedError: "",
+		},
+		"delays": {
+			configLiteral: `
+mode: s3:fake
+delays:
+  getInfo:
+    duration: 2s
+  createBucket:
+    min: 100ms
+    max: 1s
+  deleteBucket:
+    hang: true
+`,
+			expectedConfig: Config{
+				Mode: ModeS3Fake,
+				Delays: Delays{
+					GetInfo:      &Delay{Duration: 2 * time.Second},
+					CreateBucket: &Delay{Min: 100 * time.Millisecond, Max: time.Second},
+					DeleteBucket: &Delay{Hang: true},
+				},
+			},
+			expectedError: "",
+		},
+		"fake state": {
+			configLiteral: `
+mode: azure:fake
+fake:
+  statePath: /var/lib/cosi/state.json
+  server:
+    address: ":9000"
+    endpoint: http://cosi-sample-driver:9000
+`,
+			expectedConfig: Config{
+				Mode: ModeAzureFake,
+				Fake: Fake{
+					StatePath: "/var/lib/cosi/state.json",
+					Server: FakeServer{
+						Address:  ":9000",
+						Endpoint: "http://cosi-sample-driver:9000",
+					},
+				},
+			},
+			expectedError: "",
+		},
+		"local storage": {
+			configLiteral: `
+mode: s3:local
+local:
+  root: /var/lib/cosi/buckets
+`,
+			expectedConfig: Config{
+				Mode: ModeS3Local,
+				Local: Local{
+					Root: "/var/lib/cosi/buckets",
+				},
+			},
+			expectedError: "",
+		},
+		"negative delay": {
+			configLiteral: `
+delays:
+  getInfo:
+    duration: -1s
+`,
+			expectedError: "delay must not be negative",
+		},
+		"inverted delay range": {
+			configLiteral: `
+delays:
+  getInfo:
+    min: 2s
+    max: 1s
+`,
+			expectedError: "min (2s) must not be greater than max (1s)",
+		},
+		"min without max": {
+			configLiteral: `
+delays:
+  getInfo:
+    min: 2s
+`,
+			expectedError: "max is required when min is set",
+		},
+		"ambiguous delay": {
+			configLiteral: `
+delays:
+  getInfo:
+    duration: 1s
+    hang: true
+`,
+			expectedError: "only one of duration, min/max and hang can be set",
+		},
+		"invalid probability": {
+			configLiteral: `
+errors:
+  deleteBucket:
+    code: 14
+    probability: 1.5
+`,
+			expectedError: "probability must be between 0 and 1, got 1.5",
+		},
+		"negative failFirst": {
+			configLiteral: `
+errors:
+  deleteBucket:
+    code: 14
+    failFirst: -1
+`,
+			expectedError: "failFirst must not be negative, got -1",
+		},
+		"negative every": {
+			configLiteral: `
+errors:
+  deleteBucket:
+    code: 14
+    every: -2
+`,
+			expectedError: "every must not be negative, got -2",
+		},
+		"invalid bucket name pattern": {
+			configLiteral: `
+errors:
+  deleteBucket:
+    code: 14
+    match:
+      bucketName: "["
+`,
+			expectedError: `invalid bucketName pattern "["`,
+		},
+		"parameters match without parameters": {
+			configLiteral: `
+errors:
+  revokeBucketAccess:
+    code: 14
+    match:
+      parameters:
+        region: eu-west-1
+`,
+			expectedError: "revokeBucketAccess cannot match parameters, as the call has none",
+		},
+		"naming": {
+			configLiteral: `
+naming:
+  template: "{{.Prefix}}{{.ClusterID}}-{{.Name}}-{{.Hash}}"
+  prefix: cosi-
+  clusterID: prod
+  hashLength: 12
+`,
+			expectedConfig: Config{
+				Naming: Naming{
+					Template:   "{{.Prefix}}{{.ClusterID}}-{{.Name}}-{{.Hash}}",
+					Prefix:     "cosi-",
+					ClusterID:  "prod",
+					HashLength: 12,
+				},
+			},
+		},
+		"invalid naming template": {
+			configLiteral: `
+naming:
+  template: "{{.Name"
+`,
+			expectedError: "invalid naming template",
+		},
+		"unknown naming template field": {
+			configLiteral: `
+naming:
+  template: "{{.Namespace}}-{{.Name}}"
+`,
+			expectedError: "can't evaluate field Namespace",
+		},
+		"invalid hash length": {
+			configLiteral: `
+naming:
+  hashLength: 65
+`,
+			expectedError: "hashLength must be between 0 and 64, got 65",
+		},
+		"tags": {
+			configLiteral: `
+tags:
+  cluster: prod
+  cost-center: "1234"
+  empty: ""
+`,
+			expectedConfig: Config{
+				Tags: Tags{"cluster": "prod", "cost-center": "1234", "empty": ""},
+			},
+		},
+		"tag key with separator": {
+			configLiteral: `
+tags:
+  "team=a": b
+`,
+			expectedError: `invalid tag key "team=a"`,
+		},
+		"tag value with separator": {
+			configLiteral: `
+tags:
+  teams: "a,b"
+`,
+			expectedError: `invalid value of tag "teams"`,
+		},
+		"tag key with spaces": {
+			configLiteral: `
+tags:
+  " team": a
+`,
+			expectedError: `invalid tag key " team"`,
+		},
 		"missing fields": {
 			configLiteral:  ``,
 			expectedConfig: Config{},
@@ -88,3 +341,105 @@ errors:
 		})
 	}
 }
+
+func TestNaming_Execute(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		naming   Naming
+		name     string
+		expected string
+	}{
+		"default template": {
+			naming:   Naming{Prefix: "cosi-"},
+			name:     "bucket",
+			expected: "cosi-bucket",
+		},
+		"template with hash": {
+			naming:   Naming{Template: "{{.ClusterID}}-{{.Name}}-{{.Hash}}", ClusterID: "prod"},
+			name:     "bucket",
+			expected: "prod-bucket-72e2a8c3",
+		},
+		"hash length": {
+			naming:   Naming{Template: "{{.Hash}}", ClusterID: "prod", HashLength: 4},
+			name:     "bucket",
+			expected: "72e2",
+		},
+		"hash of the requested name": {
+			naming:   Naming{Template: "{{.ClusterID}}-{{.Name}}-{{.Hash}}", ClusterID: "prod"},
+			name:     "buck",
+			expected: "prod-buck-72e2a8c3",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := tc.naming.Execute(tc.name, "bucket")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestStatusError_Matches(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		match      *Match
+		bucket     string
+		parameters map[string]string
+		expected   bool
+	}{
+		"no match rule": {
+			match:    nil,
+			bucket:   "any",
+			expected: true,
+		},
+		"matching bucket pattern": {
+			match:    &Match{BucketName: "flaky-*"},
+			bucket:   "flaky-bucket",
+			expected: true,
+		},
+		"non-matching bucket pattern": {
+			match:    &Match{BucketName: "flaky-*"},
+			bucket:   "stable-bucket",
+			expected: false,
+		},
+		"matching parameters": {
+			match:      &Match{Parameters: map[string]string{"tier": "gold"}},
+			bucket:     "bucket",
+			parameters: map[string]string{"tier": "gold", "region": "eu"},
+			expected:   true,
+		},
+		"different parameter value": {
+			match:      &Match{Parameters: map[string]string{"tier": "gold"}},
+			bucket:     "bucket",
+			parameters: map[string]string{"tier": "silver"},
+			expected:   false,
+		},
+		"missing parameter": {
+			match:    &Match{Parameters: map[string]string{"tier": "gold"}},
+			bucket:   "bucket",
+			expected: false,
+		},
+		"bucket and parameters": {
+			match:      &Match{BucketName: "b*", Parameters: map[string]string{"tier": "gold"}},
+			bucket:     "bucket",
+			parameters: map[string]string{"tier": "gold"},
+			expected:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := &StatusError{Match: tc.match}
+			assert.Equal(t, tc.expected, err.Matches(tc.bucket, tc.parameters))
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// Parse decodes and validates a YAML configuration document.
+func Parse(data []byte) (Config, error) {
+	cfg := Config{}
+
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("unable to read config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Load reads and parses the configuration file at the given path.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to open config: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Store holds the active configuration and allows swapping it atomically while the driver is running.
+type Store struct {
+	active atomic.Pointer[Config]
+}
+
+// NewStore creates a Store holding the given configuration.
+func NewStore(cfg Config) *Store {
+	s := &Store{}
+	s.Set(cfg)
+	return s
+}
+
+// Get returns the active configuration.
+// Callers should get it once per request, so the request is handled with a consistent configuration.
+// A nil Store holds the zero configuration.
+func (s *Store) Get() Config {
+	if s == nil {
+		return Config{}
+	}
+
+	if cfg := s.active.Load(); cfg != nil {
+		return *cfg
+	}
+
+	return Config{}
+}
+
+// Set replaces the active configuration.
+func (s *Store) Set(cfg Config) {
+	s.active.Store(&cfg)
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// Watcher reloads the configuration file into a Store whenever its content changes.
+//
+// The file is polled rather than watched for filesystem events, as ConfigMap volumes
+// update files by swapping a symlink to a new directory, which is only reliably
+// observed by reading the file through the symlink.
+type Watcher struct {
+	Path     string        // Path of the configuration file.
+	Store    *Store        // Store receiving the reloaded configuration.
+	Interval time.Duration // Polling interval.
+
+	last []byte // Content of the last file read, successfully parsed or not.
+}
+
+// NewWatcher creates a Watcher for the file the active configuration of the store was loaded from.
+func NewWatcher(path string, store *Store, interval time.Duration) (*Watcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open config: %w", err)
+	}
+
+	return &Watcher{
+		Path:     path,
+		Store:    store,
+		Interval: interval,
+		last:     data,
+	}, nil
+}
+
+// Run polls the configuration file until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Reload(); err != nil {
+				klog.ErrorS(err, "Failed to reload config, keeping the active config", "path", w.Path)
+			}
+		}
+	}
+}
+
+// Reload reads the configuration file and, if its content changed, validates it
+// and swaps it into the store. It reports whether the active configuration was replaced.
+// On error, the active configuration is kept. The same invalid content is reported only once.
+func (w *Watcher) Reload() (bool, error) {
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		return false, fmt.Errorf("unable to open config: %w", err)
+	}
+
+	if bytes.Equal(data, w.last) {
+		return false, nil
+	}
+	w.last = data
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return false, err
+	}
+
+	old := w.Store.Get()
+	if cfg.Mode != old.Mode {
+		return false, fmt.Errorf("changing mode from %q to %q requires a restart", old.Mode, cfg.Mode)
+	}
+	if cfg.Fake != old.Fake {
+		return false, fmt.Errorf("changing fake storage from %+v to %+v requires a restart", old.Fake, cfg.Fake)
+	}
+	if cfg.Local != old.Local {
+		return false, fmt.Errorf("changing local storage from %+v to %+v requires a restart", old.Local, cfg.Local)
+	}
+	// a new name for a request retried after its bucket was created would create a second bucket
+	if cfg.Naming != old.Naming {
+		return false, fmt.Errorf("changing naming policy from %+v to %+v requires a restart", old.Naming, cfg.Naming)
+	}
+
+	w.Store.Set(cfg)
+	klog.InfoS("Config reloaded", "path", w.Path, "diff", Diff(old, cfg))
+
+	return true, nil
+}
+
+// Diff returns a line based diff of the YAML representations of two configurations.
+// Removed lines are prefixed with "-" and added lines with "+"; unchanged lines are omitted.
+func Diff(old, updated Config) string {
+	a, b := lines(old), lines(updated)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func lines(cfg Config) []string {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	initialConfig = `
+mode: s3:fake
+errors:
+  createBucket:
+    message: "Bucket creation failed"
+    code: 7
+`
+	updatedConfig = `
+mode: s3:fake
+errors:
+  createBucket:
+    message: "Bucket creation failed"
+    code: 14
+`
+)
+
+// newWatcher writes the initial config to a new file and returns a watcher for it.
+func newWatcher(t *testing.T) (*Watcher, string) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(initialConfig), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	w, err := NewWatcher(path, NewStore(cfg), time.Millisecond)
+	require.NoError(t, err)
+
+	return w, path
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		content       string
+		expectedCode  codes.Code
+		expectedSwap  bool
+		expectedError string
+	}{
+		"unchanged": {
+			content:      initialConfig,
+			expectedCode: codes.PermissionDenied,
+		},
+		"updated": {
+			content:      updatedConfig,
+			expectedCode: codes.Unavailable,
+			expectedSwap: true,
+		},
+		"invalid yaml": {
+			content:       "mode: [",
+			expectedCode:  codes.PermissionDenied,
+			expectedError: "unable to read config",
+		},
+		"invalid rule": {
+			content: `
+mode: s3:fake
+errors:
+  createBucket:
+    code: 14
+    probability: 2
+`,
+			expectedCode:  codes.PermissionDenied,
+			expectedError: "probability must be between 0 and 1",
+		},
+		"mode change": {
+			content:       "mode: azure:fake\n",
+			expectedCode:  codes.PermissionDenied,
+			expectedError: `changing mode from "s3:fake" to "azure:fake" requires a restart`,
+		},
+		"fake storage change": {
+			content:       "mode: s3:fake\nfake:\n  statePath: /tmp/state.json\n",
+			expectedCode:  codes.PermissionDenied,
+			expectedError: "changing fake storage",
+		},
+		"local storage change": {
+			content:       "mode: s3:fake\nlocal:\n  root: /var/lib/buckets\n",
+			expectedCode:  codes.PermissionDenied,
+			expectedError: "changing local storage",
+		},
+		"naming policy change": {
+			content:       "mode: s3:fake\nnaming:\n  prefix: cosi-\n",
+			expectedCode:  codes.PermissionDenied,
+			expectedError: "changing naming policy",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			w, path := newWatcher(t)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			swapped, err := w.Reload()
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedError)
+			}
+			assert.Equal(t, tc.expectedSwap, swapped)
+			assert.Equal(t, tc.expectedCode, w.Store.Get().Errors.CreateBucket.Code)
+
+			// the same content is not reported twice
+			swapped, err = w.Reload()
+			assert.NoError(t, err)
+			assert.False(t, swapped)
+		})
+	}
+}
+
+func TestWatcher_ReloadAfterInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	w, path := newWatcher(t)
+
+	require.NoError(t, os.WriteFile(path, []byte("mode: ["), 0o600))
+	_, err := w.Reload()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(updatedConfig), 0o600))
+	swapped, err := w.Reload()
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	assert.Equal(t, codes.Unavailable, w.Store.Get().Errors.CreateBucket.Code)
+}
+
+// TestWatcher_ConfigMapSwap mimics how the kubelet updates ConfigMap volumes:
+// config.yaml links to ..data/config.yaml, and ..data is atomically replaced
+// by a symlink to a new timestamped directory.
+func TestWatcher_ConfigMapSwap(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeVersion := func(version, content string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte(content), 0o600))
+		require.NoError(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	}
+
+	writeVersion("..v1", initialConfig)
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), path))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	store := NewStore(cfg)
+
+	w, err := NewWatcher(path, store, time.Millisecond)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	writeVersion("..v2", updatedConfig)
+
+	assert.Eventually(t, func() bool {
+		return store.Get().Errors.CreateBucket.Code == codes.Unavailable
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	old := Config{
+		Mode: ModeS3Fake,
+		Errors: Errors{
+			CreateBucket: &StatusError{Message: "failed", Code: codes.PermissionDenied},
+		},
+	}
+	updated := Config{
+		Mode: ModeS3Fake,
+		Errors: Errors{
+			CreateBucket: &StatusError{Message: "failed", Code: codes.Unavailable},
+			DeleteBucket: &StatusError{Message: "missing", Code: codes.NotFound},
+		},
+	}
+
+	assert.Equal(t, `-        code: 7
++        code: 14
++    deleteBucket:
++        message: missing
++        code: 5`, Diff(old, updated))
+	assert.Empty(t, Diff(old, old))
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	var nilStore *Store
+	assert.Equal(t, Config{}, nilStore.Get())
+
+	store := NewStore(Config{Mode: ModeS3Fake})
+	assert.Equal(t, ModeS3Fake, store.Get().Mode)
+
+	store.Set(Config{Mode: ModeAzureFake})
+	assert.Equal(t, ModeAzureFake, store.Get().Mode)
+}
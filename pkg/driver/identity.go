@@ -23,20 +23,40 @@ import (
 
 	"k8s.io/klog/v2"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/config"
 )
 
 var ErrEmptyDriverName = errors.New("empty driver name")
 
 // IdentityServer implements the Identity service of the COSI driver.
 type IdentityServer struct {
-	Name string
+	Name   string
+	Config *config.Store // Active configuration, read once per call as it may be reloaded.
+
+	injector injector
 }
 
 // DriverGetInfo returns information about the driver.
+//
+// Return values:
+//   - nil: The driver name was returned.
+//   - error: The configured injected error, codes.DeadlineExceeded or codes.Canceled if the call
+//     was aborted while delayed, or codes.Internal if the driver name is empty.
 func (id *IdentityServer) DriverGetInfo(
 	ctx context.Context,
 	req *cosi.DriverGetInfoRequest,
 ) (*cosi.DriverGetInfoResponse, error) {
+	cfg := id.Config.Get()
+
+	if err := id.injector.wait(ctx, cfg.Errors.Seed, cfg.Delays.GetInfo, "DriverGetInfo"); err != nil {
+		return nil, err
+	}
+
+	if err := id.injector.check(cfg.Errors, cfg.Errors.GetInfo, "DriverGetInfo", "", nil); err != nil {
+		klog.ErrorS(err, "Purposefully failing DriverGetInfo call", "name", id.Name)
+		return nil, status.Error(err.Code, err.Message)
+	}
+
 	if id.Name == "" {
 		klog.ErrorS(ErrEmptyDriverName, "Driver name cannot be empty")
 		return nil, status.Errorf(codes.Internal, "%s", ErrEmptyDriverName)
@@ -0,0 +1,153 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/config"
+)
+
+// newIdentityClient serves the identity server over an in-memory gRPC connection
+// and returns a client of it, so that tests observe what the sidecar receives.
+func newIdentityClient(t *testing.T, server cosi.IdentityServer) cosi.IdentityClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	cosi.RegisterIdentityServer(srv, server)
+	go srv.Serve(lis) //nolint:errcheck // Serve returns once the server is stopped
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return cosi.NewIdentityClient(conn)
+}
+
+func TestIdentityServer_DriverGetInfo(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		name            string
+		config          config.Config
+		expectedName    string
+		expectedCode    codes.Code
+		expectedMessage string
+	}{
+		"valid name": {
+			name:         "sample.objectstorage.k8s.io",
+			expectedName: "sample.objectstorage.k8s.io",
+			expectedCode: codes.OK,
+		},
+		"empty name": {
+			name:            "",
+			expectedCode:    codes.Internal,
+			expectedMessage: ErrEmptyDriverName.Error(),
+		},
+		"injected error": {
+			name: "sample.objectstorage.k8s.io",
+			config: config.Config{
+				Errors: config.Errors{
+					GetInfo: &config.StatusError{
+						Message: "Unable to retrieve driver info",
+						Code:    codes.Unavailable,
+					},
+				},
+			},
+			expectedCode:    codes.Unavailable,
+			expectedMessage: "Unable to retrieve driver info",
+		},
+		"injected error takes precedence over empty name": {
+			name: "",
+			config: config.Config{
+				Errors: config.Errors{
+					GetInfo: &config.StatusError{
+						Message: "Permission denied",
+						Code:    codes.PermissionDenied,
+					},
+				},
+			},
+			expectedCode:    codes.PermissionDenied,
+			expectedMessage: "Permission denied",
+		},
+		"delayed": {
+			name: "sample.objectstorage.k8s.io",
+			config: config.Config{
+				Delays: config.Delays{
+					GetInfo: &config.Delay{Duration: time.Second},
+				},
+			},
+			expectedName: "sample.objectstorage.k8s.io",
+			expectedCode: codes.OK,
+		},
+		"hang until deadline": {
+			name: "sample.objectstorage.k8s.io",
+			config: config.Config{
+				Delays: config.Delays{
+					GetInfo: &config.Delay{Hang: true},
+				},
+			},
+			expectedCode:    codes.DeadlineExceeded,
+			expectedMessage: context.DeadlineExceeded.Error(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := newIdentityClient(t, &IdentityServer{
+				Name:     tc.name,
+				Config:   config.NewStore(tc.config),
+				injector: injector{clock: &fakeClock{}},
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			resp, err := client.DriverGetInfo(ctx, &cosi.DriverGetInfoRequest{})
+
+			st, ok := status.FromError(err)
+			assert.True(t, ok, "error must be a gRPC status")
+			assert.Equal(t, tc.expectedCode, st.Code())
+			assert.Equal(t, tc.expectedMessage, st.Message())
+
+			if tc.expectedCode == codes.OK {
+				assert.Equal(t, tc.expectedName, resp.GetName())
+			} else {
+				assert.Nil(t, resp)
+			}
+		})
+	}
+}
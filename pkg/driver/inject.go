@@ -0,0 +1,185 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/cosi-driver-sample/pkg/config"
+)
+
+// clock abstracts waiting, so tests can control injected delays.
+type clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// injector evaluates error and delay injection rules per request.
+// It keeps per-call counters and the random source used for probabilistic errors and random delays.
+// The zero value is ready to use.
+type injector struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	seed   *int64
+	counts map[string]*ruleCount // Counters of matching calls, by call name.
+	clock  clock                 // Clock used for delays, the real clock if nil.
+}
+
+// ruleCount counts the calls matching a rule. It holds a copy of the rule, so that reloading
+// an unchanged configuration keeps counting while changing the rule starts counting from scratch.
+type ruleCount struct {
+	rule config.StatusError
+	n    int
+}
+
+// check returns the rule if the named call for the given bucket and parameters must fail, or nil otherwise.
+func (i *injector) check(
+	errs config.Errors,
+	rule *config.StatusError,
+	call string,
+	bucket string,
+	parameters map[string]string,
+) *config.StatusError {
+	if rule == nil {
+		// forget the counter, so that adding the rule back starts counting from scratch
+		i.mu.Lock()
+		delete(i.counts, call)
+		i.mu.Unlock()
+		return nil
+	}
+	if !rule.Matches(bucket, parameters) {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	n := i.count(call, rule)
+
+	if rule.FailFirst > 0 && n > rule.FailFirst {
+		return nil
+	}
+
+	if rule.Every > 0 && n%rule.Every != 0 {
+		return nil
+	}
+
+	if p := rule.Probability; p != nil && i.random(errs.Seed).Float64() >= *p {
+		return nil
+	}
+
+	return rule
+}
+
+// count increments and returns the number of calls matching the rule, resetting it if the rule changed.
+// The caller must hold the lock.
+func (i *injector) count(call string, rule *config.StatusError) int {
+	if i.counts == nil {
+		i.counts = map[string]*ruleCount{}
+	}
+
+	c, ok := i.counts[call]
+	if !ok || !reflect.DeepEqual(c.rule, *rule) {
+		c = &ruleCount{rule: *rule}
+		i.counts[call] = c
+	}
+	c.n++
+
+	return c.n
+}
+
+// wait sleeps for the configured delay before the named call is handled.
+// It returns a status error matching the context error if ctx is done before the delay elapses.
+func (i *injector) wait(ctx context.Context, seed *int64, delay *config.Delay, call string) error {
+	if delay == nil {
+		return nil
+	}
+
+	var done <-chan time.Time // nil channel, blocks until ctx is done
+	if !delay.Hang {
+		d := i.duration(seed, delay)
+		if d <= 0 {
+			return nil
+		}
+
+		klog.InfoS("Purposefully delaying driver call", "call", call, "delay", d)
+		done = i.after(d)
+	} else {
+		klog.InfoS("Purposefully hanging driver call until its context is done", "call", call)
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		err := status.FromContextError(ctx.Err()).Err()
+		klog.ErrorS(err, "Driver call aborted while delayed", "call", call)
+		return err
+	}
+}
+
+// duration returns the fixed delay, or a random one within the configured range.
+func (i *injector) duration(seed *int64, delay *config.Delay) time.Duration {
+	if delay.Max == 0 {
+		return delay.Duration
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return delay.Min + time.Duration(i.random(seed).Int63n(int64(delay.Max-delay.Min)+1))
+}
+
+func (i *injector) after(d time.Duration) <-chan time.Time {
+	if i.clock == nil {
+		return realClock{}.After(d)
+	}
+	return i.clock.After(d)
+}
+
+// random returns the random source, (re)seeding it when the configured seed changes.
+func (i *injector) random(seed *int64) *rand.Rand {
+	if i.rand != nil && equalSeed(i.seed, seed) {
+		return i.rand
+	}
+
+	if seed != nil {
+		i.rand = rand.New(rand.NewSource(*seed))
+	} else {
+		i.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	i.seed = seed
+
+	return i.rand
+}
+
+func equalSeed(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
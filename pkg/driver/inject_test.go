@@ -0,0 +1,272 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/cosi-driver-sample/pkg/config"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// fakeClock records requested delays. Unless blocked, they elapse immediately.
+type fakeClock struct {
+	mu      sync.Mutex
+	blocked bool
+	waits   []time.Duration
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.waits = append(c.waits, d)
+	if c.blocked {
+		return nil
+	}
+
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+func (c *fakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waits
+}
+
+// failures evaluates the rule n times and returns which calls failed.
+func failures(i *injector, errs config.Errors, rule *config.StatusError, n int) []bool {
+	out := make([]bool, n)
+	for k := range out {
+		out[k] = i.check(errs, rule, "DriverDeleteBucket", "bucket", nil) != nil
+	}
+	return out
+}
+
+func TestInjector_Check(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rule     *config.StatusError
+		expected []bool
+	}{
+		"no rule": {
+			rule:     nil,
+			expected: []bool{false, false, false},
+		},
+		"always": {
+			rule:     &config.StatusError{Code: codes.Internal},
+			expected: []bool{true, true, true},
+		},
+		"fail first": {
+			rule:     &config.StatusError{Code: codes.Unavailable, FailFirst: 2},
+			expected: []bool{true, true, false, false},
+		},
+		"every": {
+			rule:     &config.StatusError{Code: codes.Unavailable, Every: 3},
+			expected: []bool{false, false, true, false, false, true},
+		},
+		"fail first and every": {
+			rule:     &config.StatusError{Code: codes.Unavailable, FailFirst: 4, Every: 2},
+			expected: []bool{false, true, false, true, false, false},
+		},
+		"never": {
+			rule:     &config.StatusError{Code: codes.Unavailable, Probability: ptr(0.0)},
+			expected: []bool{false, false, false},
+		},
+		"certain": {
+			rule:     &config.StatusError{Code: codes.Unavailable, Probability: ptr(1.0)},
+			expected: []bool{true, true, true},
+		},
+		"non-matching bucket": {
+			rule: &config.StatusError{
+				Code:  codes.Unavailable,
+				Match: &config.Match{BucketName: "other"},
+			},
+			expected: []bool{false, false},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, failures(&injector{}, config.Errors{}, tc.rule, len(tc.expected)))
+		})
+	}
+}
+
+func TestInjector_CountsOnlyMatchingCalls(t *testing.T) {
+	t.Parallel()
+
+	i := &injector{}
+	rule := &config.StatusError{
+		Code:      codes.Unavailable,
+		FailFirst: 1,
+		Match:     &config.Match{Parameters: map[string]string{"tier": "gold"}},
+	}
+
+	check := func(tier string) *config.StatusError {
+		return i.check(config.Errors{}, rule, "DriverCreateBucket", "bucket", map[string]string{"tier": tier})
+	}
+
+	assert.Nil(t, check("silver"))
+	assert.Equal(t, rule, check("gold"))
+	assert.Nil(t, check("gold"))
+}
+
+func TestInjector_ReloadedRules(t *testing.T) {
+	t.Parallel()
+
+	i := &injector{}
+	rule := func() *config.StatusError {
+		return &config.StatusError{Code: codes.Unavailable, FailFirst: 2}
+	}
+
+	assert.Equal(t, []bool{true}, failures(i, config.Errors{}, rule(), 1))
+	assert.Equal(t, []bool{true, false}, failures(i, config.Errors{}, rule(), 2),
+		"reloading an unchanged rule must keep counting")
+
+	changed := &config.StatusError{Code: codes.Unavailable, FailFirst: 1}
+	assert.Equal(t, []bool{true, false}, failures(i, config.Errors{}, changed, 2),
+		"a changed rule must start counting from scratch")
+
+	assert.NotNil(t, i.check(config.Errors{}, rule(), "DriverGrantBucketAccess", "bucket", nil),
+		"other calls must have their own counter")
+	assert.Len(t, i.counts, 2)
+
+	assert.Equal(t, []bool{false, false}, failures(i, config.Errors{}, nil, 2))
+	assert.Equal(t, []bool{true, true, false}, failures(i, config.Errors{}, rule(), 3),
+		"a removed rule must start counting from scratch when added back")
+}
+
+func TestInjector_Seed(t *testing.T) {
+	t.Parallel()
+
+	rule := &config.StatusError{Code: codes.Unavailable, Probability: ptr(0.5)}
+	errs := config.Errors{Seed: ptr(int64(7))}
+
+	first := failures(&injector{}, errs, rule, 64)
+	second := failures(&injector{}, errs, rule, 64)
+	assert.Equal(t, first, second, "same seed must produce the same failures")
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+
+	other := failures(&injector{}, config.Errors{Seed: ptr(int64(8))}, rule, 64)
+	assert.NotEqual(t, first, other)
+}
+
+func TestInjector_Wait(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		delay         *config.Delay
+		blocked       bool
+		cancel        bool
+		expectedWaits []time.Duration
+		expectedCode  codes.Code
+	}{
+		"no delay": {
+			delay:        nil,
+			expectedCode: codes.OK,
+		},
+		"fixed delay": {
+			delay:         &config.Delay{Duration: 2 * time.Second},
+			expectedWaits: []time.Duration{2 * time.Second},
+			expectedCode:  codes.OK,
+		},
+		"degenerate range": {
+			delay:         &config.Delay{Min: time.Second, Max: time.Second},
+			expectedWaits: []time.Duration{time.Second},
+			expectedCode:  codes.OK,
+		},
+		"deadline exceeded while delayed": {
+			delay:         &config.Delay{Duration: time.Minute},
+			blocked:       true,
+			expectedWaits: []time.Duration{time.Minute},
+			expectedCode:  codes.DeadlineExceeded,
+		},
+		"canceled while delayed": {
+			delay:         &config.Delay{Duration: time.Minute},
+			blocked:       true,
+			cancel:        true,
+			expectedWaits: []time.Duration{time.Minute},
+			expectedCode:  codes.Canceled,
+		},
+		"hang until deadline": {
+			delay:        &config.Delay{Hang: true},
+			expectedCode: codes.DeadlineExceeded,
+		},
+		"hang until canceled": {
+			delay:        &config.Delay{Hang: true},
+			cancel:       true,
+			expectedCode: codes.Canceled,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &fakeClock{blocked: tc.blocked}
+			i := &injector{clock: clock}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+
+			err := i.wait(ctx, nil, tc.delay, "DriverTest")
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			assert.Equal(t, tc.expectedWaits, clock.Waits())
+		})
+	}
+}
+
+func TestInjector_WaitRandomRange(t *testing.T) {
+	t.Parallel()
+
+	delay := &config.Delay{Min: time.Second, Max: 3 * time.Second}
+	seed := ptr(int64(7))
+
+	waits := func() []time.Duration {
+		clock := &fakeClock{}
+		i := &injector{clock: clock}
+		for range 32 {
+			assert.NoError(t, i.wait(context.Background(), seed, delay, "DriverTest"))
+		}
+		return clock.Waits()
+	}
+
+	first := waits()
+	for _, d := range first {
+		assert.GreaterOrEqual(t, d, delay.Min)
+		assert.LessOrEqual(t, d, delay.Max)
+	}
+	assert.Equal(t, first, waits(), "same seed must produce the same delays")
+}
@@ -17,6 +17,8 @@ package driver
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -27,38 +29,69 @@ import (
 	"sigs.k8s.io/cosi-driver-sample/pkg/config"
 )
 
-var ErrBucketNotFound = errors.New("bucket not found")
+// ErrBucketNotFound is returned when granting access to a bucket that does not exist.
+var ErrBucketNotFound = clients.ErrBucketNotFound
 
 // ProvisionerServer implements the COSI driver server interface.
 type ProvisionerServer struct {
 	Client clients.Client
-	Config config.Config
+	Config *config.Store // Active configuration, read once per call as it may be reloaded.
+
+	injector injector
 }
 
 // DriverCreateBucket creates a bucket if it does not already exist.
 // If the bucket exists and the parameters match, it returns success without error.
 // If the bucket exists but the parameters differ, it returns a conflict error.
+// The bucket is named after the naming policy of the configuration, unless its ID is overridden.
+// The static tags of the configuration are merged into the tags parameter of new buckets, for clients
+// supporting it. They are left out when comparing existing buckets, as they may have changed since.
+// The name and parameters are validated against the rules of the client before the backend is contacted.
 //
 // Return values:
 //   - nil: The bucket was successfully created or already exists with matching parameters.
-//   - codes.AlreadyExists: The bucket already exists but with different parameters.
+//   - codes.InvalidArgument: The name or parameters break the rules of the client, or are rejected by the backend.
+//   - codes.AlreadyExists: The bucket already exists but with different parameters, or is owned by someone else.
+//   - codes.PermissionDenied: The backend rejected the credentials of the driver.
+//   - codes.Unavailable: The backend is throttling requests, the call should be retried later.
 //   - error: Internal error requiring retries.
 func (s *ProvisionerServer) DriverCreateBucket(
 	ctx context.Context,
 	req *cosi.DriverCreateBucketRequest,
 ) (*cosi.DriverCreateBucketResponse, error) {
-	bucketName, overridden := s.getName(req)
+	cfg := s.Config.Get()
 	parameters := req.GetParameters()
 
-	if err := s.Config.Errors.CreateBucket; err != nil {
+	bucketName, overridden, err := getBucketName(cfg, s.Client.NameRules(), req)
+	if err != nil {
+		klog.ErrorS(err, "Failed to generate bucket name", "name", req.GetName())
+		return nil, statusError(err)
+	}
+
+	if err := s.delay(ctx, cfg, cfg.Delays.CreateBucket, "DriverCreateBucket"); err != nil {
+		return nil, err
+	}
+
+	if err := s.injectedError(cfg, cfg.Errors.CreateBucket, "DriverCreateBucket", bucketName, parameters); err != nil {
 		klog.ErrorS(err, "Purposefully failing DriverCreateBucket call", "bucket", bucketName, "parameters", parameters)
 		return nil, status.Error(err.Code, err.Message)
 	}
 
+	tagged, err := withStaticTags(cfg.Tags, s.Client.ParameterSchema(), parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid bucket tags", "bucket", bucketName, "parameters", parameters)
+		return nil, statusError(err)
+	}
+
+	if err := s.Client.ParameterSchema().Validate(parameters); err != nil {
+		klog.ErrorS(err, "Invalid bucket parameters", "bucket", bucketName, "parameters", parameters)
+		return nil, statusError(err)
+	}
+
 	exists, err := s.Client.BucketExists(ctx, bucketName)
 	if err != nil {
 		klog.ErrorS(err, "Failed to check bucket existence", "bucket", bucketName, "parameters", parameters)
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, statusError(err)
 	}
 	if exists {
 		if overridden {
@@ -67,9 +100,13 @@ func (s *ProvisionerServer) DriverCreateBucket(
 		}
 
 		equal, err := s.Client.IsBucketEqual(ctx, bucketName, parameters)
+		if errors.Is(err, clients.ErrBucketAlreadyExists) {
+			klog.InfoS("Bucket already exists with a differing immutable parameter", "bucket", bucketName, "reason", err)
+			return nil, statusError(err)
+		}
 		if err != nil {
 			klog.ErrorS(err, "Failed to compare bucket with expected parameters", "bucket", bucketName, "parameters", parameters)
-			return nil, status.Errorf(codes.Internal, "%s", err)
+			return nil, statusError(err)
 		}
 		if equal {
 			klog.InfoS("Bucket already exists with matching parameters", "bucket", bucketName)
@@ -80,9 +117,9 @@ func (s *ProvisionerServer) DriverCreateBucket(
 		return nil, status.Errorf(codes.AlreadyExists, "bucket already exists: %s", bucketName)
 	}
 
-	if err := s.Client.CreateBucket(ctx, bucketName, parameters); err != nil {
+	if err := s.Client.CreateBucket(ctx, bucketName, tagged); err != nil {
 		klog.ErrorS(err, "Failed to create bucket", "bucket", bucketName)
-		return nil, err
+		return nil, statusError(err)
 	}
 
 	klog.InfoS("Bucket successfully created", "bucket", bucketName)
@@ -96,21 +133,37 @@ func (s *ProvisionerServer) DriverCreateBucket(
 //
 // Return values:
 //   - nil: The bucket was successfully deleted or does not exist.
+//   - codes.FailedPrecondition: The bucket still holds objects the client is not allowed to remove.
+//   - codes.PermissionDenied: The backend rejected the credentials of the driver.
+//   - codes.Unavailable: The backend is throttling requests, the call should be retried later.
 //   - error: Internal error requiring retries.
 func (s *ProvisionerServer) DriverDeleteBucket(
 	ctx context.Context,
 	req *cosi.DriverDeleteBucketRequest,
 ) (*cosi.DriverDeleteBucketResponse, error) {
-	bucketId := s.getBucketID(req)
+	cfg := s.Config.Get()
+	bucketId := getBucketID(cfg, req)
+
+	if err := s.delay(ctx, cfg, cfg.Delays.DeleteBucket, "DriverDeleteBucket"); err != nil {
+		return nil, err
+	}
 
-	if err := s.Config.Errors.DeleteBucket; err != nil {
+	if err := s.injectedError(cfg, cfg.Errors.DeleteBucket, "DriverDeleteBucket", bucketId, nil); err != nil {
 		klog.ErrorS(err, "Purposefully failing DriverDeleteBucket call", "bucket", bucketId)
 		return nil, status.Error(err.Code, err.Message)
 	}
 
 	if err := s.Client.DeleteBucket(ctx, bucketId); err != nil {
-		klog.ErrorS(err, "Failed to delete bucket", "bucket", bucketId)
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		switch {
+		case errors.Is(err, clients.ErrBucketNotFound):
+			klog.InfoS("Bucket does not exist, nothing to delete", "bucket", bucketId)
+			return &cosi.DriverDeleteBucketResponse{}, nil
+		case errors.Is(err, clients.ErrBucketNotEmpty):
+			klog.ErrorS(err, "Refusing to delete non-empty bucket", "bucket", bucketId)
+		default:
+			klog.ErrorS(err, "Failed to delete bucket", "bucket", bucketId)
+		}
+		return nil, statusError(err)
 	}
 
 	klog.InfoS("Bucket successfully deleted", "bucket", bucketId)
@@ -121,15 +174,27 @@ func (s *ProvisionerServer) DriverDeleteBucket(
 //
 // Return values:
 //   - nil: Access successfully granted.
+//   - codes.NotFound: The bucket does not exist.
+//   - codes.ResourceExhausted: The bucket already has as many accesses as the backend allows.
+//   - codes.Unimplemented: The client cannot grant accesses on its backend.
+//   - codes.PermissionDenied: The backend rejected the credentials of the driver.
+//   - codes.Unavailable: The backend is throttling requests, the call should be retried later.
 //   - error: Internal error requiring retries.
 func (s *ProvisionerServer) DriverGrantBucketAccess(
 	ctx context.Context,
 	req *cosi.DriverGrantBucketAccessRequest,
 ) (*cosi.DriverGrantBucketAccessResponse, error) {
-	bucketId := s.getBucketID(req)
-	name, _ := s.getName(req)
+	cfg := s.Config.Get()
+	bucketId := getBucketID(cfg, req)
+	name, _ := getName(cfg, req)
 
-	if err := s.Config.Errors.GrantBucketAccess; err != nil {
+	if err := s.delay(ctx, cfg, cfg.Delays.GrantBucketAccess, "DriverGrantBucketAccess"); err != nil {
+		return nil, err
+	}
+
+	if err := s.injectedError(
+		cfg, cfg.Errors.GrantBucketAccess, "DriverGrantBucketAccess", bucketId, req.GetParameters(),
+	); err != nil {
 		klog.ErrorS(err, "Purposefully failing DriverGrantBucketAccess call", "bucket", bucketId, "account", name)
 		return nil, status.Error(err.Code, err.Message)
 	}
@@ -137,7 +202,7 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(
 	exists, err := s.Client.BucketExists(ctx, bucketId)
 	if err != nil {
 		klog.ErrorS(err, "Failed to check bucket existence", "bucket", bucketId, "account", name)
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, statusError(err)
 	}
 	if !exists {
 		klog.ErrorS(ErrBucketNotFound, "Cannot grant access to nonexistent bucket", "bucket", bucketId, "account", name)
@@ -147,7 +212,7 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(
 	access, err := s.Client.CreateBucketAccess(ctx, bucketId, name)
 	if err != nil {
 		klog.ErrorS(err, "Failed to create bucket access", "bucket", bucketId, "account", name)
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, statusError(err)
 	}
 
 	klog.InfoS("Bucket access successfully granted", "name", access.Name())
@@ -163,42 +228,155 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(
 }
 
 // DriverRevokeBucketAccess revokes access to a bucket for a specific account.
-// If the access does not exist, it returns success.
+// If the access or the bucket does not exist, it returns success.
 //
 // Return values:
 //   - nil: Access successfully revoked or does not exist.
+//   - codes.PermissionDenied: The backend rejected the credentials of the driver.
+//   - codes.Unavailable: The backend is throttling requests, the call should be retried later.
 //   - error: Internal error requiring retries.
 func (s *ProvisionerServer) DriverRevokeBucketAccess(
 	ctx context.Context,
 	req *cosi.DriverRevokeBucketAccessRequest,
 ) (*cosi.DriverRevokeBucketAccessResponse, error) {
-	bucketId := s.getBucketID(req)
+	cfg := s.Config.Get()
+	bucketId := getBucketID(cfg, req)
 	accountId := req.GetAccountId()
 
-	if err := s.Config.Errors.RevokeBucketAccess; err != nil {
+	if err := s.delay(ctx, cfg, cfg.Delays.RevokeBucketAccess, "DriverRevokeBucketAccess"); err != nil {
+		return nil, err
+	}
+
+	if err := s.injectedError(cfg, cfg.Errors.RevokeBucketAccess, "DriverRevokeBucketAccess", bucketId, nil); err != nil {
 		klog.ErrorS(err, "Purposefully failing DriverRevokeBucketAccess call", "bucket", bucketId, "account", accountId)
 		return nil, status.Error(err.Code, err.Message)
 	}
 
 	if err := s.Client.DeleteBucketAccess(ctx, bucketId, accountId); err != nil {
+		if errors.Is(err, clients.ErrBucketNotFound) {
+			klog.InfoS("Bucket does not exist, nothing to revoke", "bucket", bucketId, "account", accountId)
+			return &cosi.DriverRevokeBucketAccessResponse{}, nil
+		}
+
 		klog.ErrorS(err, "Failed to revoke bucket access", "bucket", bucketId, "account", accountId)
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, statusError(err)
 	}
 
 	klog.InfoS("Bucket access successfully revoked", "bucket", bucketId, "account", accountId)
 	return &cosi.DriverRevokeBucketAccessResponse{}, nil
 }
 
-func (s *ProvisionerServer) getName(req interface{ GetName() string }) (string, bool) {
-	if id := s.Config.Overrides.BucketID; id != "" {
-		return id, false
+// statusError converts an error returned by the client into a gRPC status error,
+// with a code matching the error vocabulary of the clients package.
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, clients.ErrInvalidParameters), errors.Is(err, clients.ErrInvalidBucketName):
+		code = codes.InvalidArgument
+	case errors.Is(err, clients.ErrBucketNotFound):
+		code = codes.NotFound
+	case errors.Is(err, clients.ErrBucketAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, clients.ErrBucketNotEmpty):
+		code = codes.FailedPrecondition
+	case errors.Is(err, clients.ErrPermissionDenied):
+		code = codes.PermissionDenied
+	case errors.Is(err, clients.ErrAccessLimitReached):
+		code = codes.ResourceExhausted
+	case errors.Is(err, clients.ErrNotSupported):
+		code = codes.Unimplemented
+	case errors.Is(err, clients.ErrThrottled):
+		code = codes.Unavailable
 	}
 
-	return req.GetName(), true
+	return status.Error(code, err.Error())
+}
+
+// delay sleeps for the configured delay before the call is handled, honoring ctx cancellation.
+func (s *ProvisionerServer) delay(ctx context.Context, cfg config.Config, delay *config.Delay, call string) error {
+	return s.injector.wait(ctx, cfg.Errors.Seed, delay, call)
+}
+
+// injectedError returns the configured error if the call must purposefully fail.
+func (s *ProvisionerServer) injectedError(
+	cfg config.Config,
+	rule *config.StatusError,
+	call string,
+	bucket string,
+	parameters map[string]string,
+) *config.StatusError {
+	return s.injector.check(cfg.Errors, rule, call, bucket, parameters)
+}
+
+func getName(cfg config.Config, req interface{ GetName() string }) (string, bool) {
+	if id := cfg.Overrides.BucketID; id != "" {
+		return id, true
+	}
+
+	return req.GetName(), false
+}
+
+// getBucketName returns the name of the bucket to create: the overridden bucket ID, or the requested name
+// formatted with the naming policy, sanitized and shortened to follow the naming rules of the backend.
+func getBucketName(
+	cfg config.Config,
+	rules clients.NameRules,
+	req interface{ GetName() string },
+) (string, bool, error) {
+	if id, overridden := getName(cfg, req); overridden {
+		return id, true, nil
+	}
+
+	requested := req.GetName()
+	name := []rune(requested)
+	for {
+		formatted, err := cfg.Naming.Execute(string(name), requested)
+		if err != nil {
+			return "", false, err
+		}
+
+		// The requested name is shortened first, keeping the prefix and hash of the name intact.
+		sanitized := rules.Sanitize(formatted)
+		excess := len(sanitized) - rules.MaxLength
+		if excess <= 0 || len(name) == 0 {
+			sanitized = rules.Truncate(sanitized)
+			return sanitized, false, rules.Validate(sanitized)
+		}
+		name = name[:max(len(name)-excess, 0)]
+	}
+}
+
+// withStaticTags returns the parameters with the static tags merged into the tags parameter,
+// unless the schema of the client lacks the tags parameter. Tags of the BucketClass take precedence.
+// The parameters of the request are left unchanged.
+func withStaticTags(
+	static config.Tags,
+	schema clients.Schema,
+	parameters map[string]string,
+) (map[string]string, error) {
+	if len(static) == 0 {
+		return parameters, nil
+	}
+	if _, ok := schema.Lookup(clients.TagsKey); !ok && schema != nil {
+		return parameters, nil
+	}
+
+	tags, err := clients.ParseTags(parameters[clients.TagsKey])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s value: %w", clients.ErrInvalidParameters, clients.TagsKey, err)
+	}
+
+	merged := maps.Clone(static)
+	maps.Copy(merged, tags)
+
+	out := make(map[string]string, len(parameters)+1)
+	maps.Copy(out, parameters)
+	out[clients.TagsKey] = clients.FormatTags(merged)
+	return out, nil
 }
 
-func (s *ProvisionerServer) getBucketID(req interface{ GetBucketId() string }) string {
-	if id := s.Config.Overrides.BucketID; id != "" {
+func getBucketID(cfg config.Config, req interface{ GetBucketId() string }) string {
+	if id := cfg.Overrides.BucketID; id != "" {
 		return id
 	}
 
@@ -0,0 +1,606 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/fake"
+	"sigs.k8s.io/cosi-driver-sample/pkg/clients/local"
+	"sigs.k8s.io/cosi-driver-sample/pkg/config"
+)
+
+func TestProvisionerServer_InjectedErrors(t *testing.T) {
+	t.Parallel()
+
+	server := &ProvisionerServer{
+		Client: fake.New("s3"),
+		Config: config.NewStore(config.Config{
+			Errors: config.Errors{
+				CreateBucket: &config.StatusError{
+					Message:   "Flaky backend",
+					Code:      codes.Unavailable,
+					FailFirst: 2,
+					Match:     &config.Match{BucketName: "flaky-*"},
+				},
+			},
+		}),
+	}
+
+	create := func(name string) codes.Code {
+		_, err := server.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: name})
+		return status.Code(err)
+	}
+
+	assert.Equal(t, codes.OK, create("stable-bucket"))
+	assert.Equal(t, codes.Unavailable, create("flaky-bucket"))
+	assert.Equal(t, codes.Unavailable, create("flaky-bucket"))
+	assert.Equal(t, codes.OK, create("flaky-bucket"))
+	assert.Equal(t, codes.OK, create("flaky-bucket"))
+}
+
+func TestProvisionerServer_InjectedErrorsPerCall(t *testing.T) {
+	t.Parallel()
+
+	rule := &config.StatusError{Message: "Access grant failed", Code: codes.Internal, Every: 2}
+	server := &ProvisionerServer{
+		Client: fake.New("s3"),
+		Config: config.NewStore(config.Config{
+			Errors: config.Errors{
+				GrantBucketAccess: rule,
+				RevokeBucketAccess: &config.StatusError{
+					Message: "Access revocation failed",
+					Code:    codes.NotFound,
+				},
+			},
+		}),
+	}
+
+	_, err := server.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: "bucket"})
+	assert.NoError(t, err)
+
+	grant := func() error {
+		_, err := server.DriverGrantBucketAccess(context.Background(), &cosi.DriverGrantBucketAccessRequest{
+			BucketId: "bucket",
+			Name:     "access",
+		})
+		return err
+	}
+
+	assert.NoError(t, grant())
+	err = grant()
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "Access grant failed", status.Convert(err).Message())
+	assert.NoError(t, grant())
+
+	_, err = server.DriverRevokeBucketAccess(context.Background(), &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "bucket",
+		AccountId: "access",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestProvisionerServer_ReloadedConfig(t *testing.T) {
+	t.Parallel()
+
+	failFirst := func(code codes.Code) config.Config {
+		return config.Config{
+			Errors: config.Errors{
+				DeleteBucket: &config.StatusError{Message: "Injected", Code: code, FailFirst: 1},
+			},
+		}
+	}
+
+	store := config.NewStore(failFirst(codes.Unavailable))
+	server := &ProvisionerServer{
+		Client: fake.New("s3"),
+		Config: store,
+	}
+
+	deleteBucket := func() codes.Code {
+		_, err := server.DriverDeleteBucket(context.Background(), &cosi.DriverDeleteBucketRequest{BucketId: "bucket"})
+		return status.Code(err)
+	}
+
+	assert.Equal(t, codes.Unavailable, deleteBucket())
+	assert.Equal(t, codes.OK, deleteBucket())
+
+	// a reloaded rule starts counting from scratch
+	store.Set(failFirst(codes.PermissionDenied))
+	assert.Equal(t, codes.PermissionDenied, deleteBucket())
+	assert.Equal(t, codes.OK, deleteBucket())
+}
+
+func TestProvisionerServer_DeleteNonEmptyBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	client, err := local.New(root)
+	require.NoError(t, err)
+
+	server := &ProvisionerServer{
+		Client: client,
+		Config: config.NewStore(config.Config{Mode: config.ModeS3Local}),
+	}
+
+	for name, params := range map[string]map[string]string{
+		"kept":   nil,
+		"forced": {"forceDelete": "true"},
+	} {
+		_, err := server.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: name, Parameters: params})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(root, name, "object"), []byte("data"), 0o600))
+	}
+
+	_, err = server.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "kept"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = server.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "forced"})
+	assert.NoError(t, err)
+}
+
+func TestProvisionerServer_BucketNaming(t *testing.T) {
+	t.Parallel()
+
+	longName := "bucketclaim-" + strings.Repeat("x", 60)
+
+	tests := map[string]struct {
+		platform     string
+		naming       config.Naming
+		overrides    config.Overrides
+		name         string
+		expected     string
+		expectedCode codes.Code
+	}{
+		"default policy": {
+			platform: "s3",
+			name:     "bucketclaim-0123",
+			expected: "bucketclaim-0123",
+		},
+		"sanitized name": {
+			platform: "s3",
+			naming:   config.Naming{Prefix: "COSI_"},
+			name:     "My_Bucket",
+			expected: "cosi-my-bucket",
+		},
+		"template with cluster and hash": {
+			platform: "azure",
+			naming:   config.Naming{Template: "{{.ClusterID}}-{{.Name}}-{{.Hash}}", ClusterID: "prod", HashLength: 4},
+			name:     "bucket.v1",
+			expected: "prod-bucket-v1-7bc9",
+		},
+		"truncated name keeps the hash": {
+			platform: "gcs",
+			naming:   config.Naming{Template: "{{.Prefix}}{{.Name}}-{{.Hash}}", Prefix: "cosi-"},
+			name:     longName,
+			expected: "cosi-bucketclaim-" + strings.Repeat("x", 37) + "-" + config.Naming{}.Hash(longName),
+		},
+		"invalid name": {
+			platform:     "gcs",
+			naming:       config.Naming{Prefix: "goog-"},
+			name:         "bucket",
+			expectedCode: codes.InvalidArgument,
+		},
+		"overridden bucket id": {
+			platform:  "s3",
+			naming:    config.Naming{Prefix: "cosi-"},
+			overrides: config.Overrides{BucketID: "Existing_Bucket"},
+			name:      "bucket",
+			expected:  "Existing_Bucket",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := &ProvisionerServer{
+				Client: fake.New(tc.platform),
+				Config: config.NewStore(config.Config{Naming: tc.naming, Overrides: tc.overrides}),
+			}
+
+			resp, err := server.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: tc.name})
+			if tc.expectedCode != codes.OK {
+				assert.Equal(t, tc.expectedCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resp.GetBucketId())
+		})
+	}
+}
+
+func TestProvisionerServer_OverriddenBucketID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	existing := map[string]string{"region": "eu-west-1"}
+	differing := map[string]string{"region": "us-east-1"}
+
+	tests := map[string]struct {
+		overrides    config.Overrides
+		params       map[string]string
+		expectedCode codes.Code
+	}{
+		"overridden bucket with matching parameters": {
+			overrides: config.Overrides{BucketID: "existing"},
+			params:    existing,
+		},
+		"overridden bucket skips the parameters check": {
+			overrides: config.Overrides{BucketID: "existing"},
+			params:    differing,
+		},
+		"requested bucket with matching parameters": {
+			params: existing,
+		},
+		"requested bucket with differing parameters": {
+			params:       differing,
+			expectedCode: codes.AlreadyExists,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := fake.New("s3")
+			require.NoError(t, client.CreateBucket(ctx, "existing", existing))
+			server := &ProvisionerServer{
+				Client: client,
+				Config: config.NewStore(config.Config{Overrides: tc.overrides}),
+			}
+
+			resp, err := server.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{
+				Name:       "existing",
+				Parameters: tc.params,
+			})
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			if tc.expectedCode == codes.OK {
+				assert.Equal(t, "existing", resp.GetBucketId())
+			}
+			assert.Equal(t, existing, client.Buckets()["existing"].Parameters, "the bucket is left unchanged")
+		})
+	}
+}
+
+// failingCreateClient is a fake client whose CreateBucket calls fail with the given error.
+type failingCreateClient struct {
+	clients.Client
+	err error
+}
+
+func (c *failingCreateClient) CreateBucket(context.Context, string, map[string]string) error {
+	return c.err
+}
+
+func TestProvisionerServer_CreateBucketErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err      error
+		expected codes.Code
+	}{
+		"invalid parameters": {
+			err:      fmt.Errorf("%w: invalid objectLocking value: invalid syntax", clients.ErrInvalidParameters),
+			expected: codes.InvalidArgument,
+		},
+		"bucket owned by someone else": {
+			err:      fmt.Errorf("%w: BucketAlreadyExists", clients.ErrBucketAlreadyExists),
+			expected: codes.AlreadyExists,
+		},
+		"permission denied": {
+			err:      fmt.Errorf("%w: InvalidAccessKeyId", clients.ErrPermissionDenied),
+			expected: codes.PermissionDenied,
+		},
+		"throttled": {
+			err:      fmt.Errorf("%w: SlowDown", clients.ErrThrottled),
+			expected: codes.Unavailable,
+		},
+		"unknown error": {
+			err:      errors.New("connection refused"),
+			expected: codes.Internal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := &ProvisionerServer{
+				Client: &failingCreateClient{Client: fake.New("s3"), err: tc.err},
+				Config: config.NewStore(config.Config{}),
+			}
+
+			_, err := server.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: "bucket"})
+			assert.Equal(t, tc.expected, status.Code(err))
+			assert.Equal(t, tc.err.Error(), status.Convert(err).Message())
+		})
+	}
+}
+
+func TestProvisionerServer_CreateBucketInvalidParameters(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		params      map[string]string
+		expectedMsg string
+	}{
+		"unknown parameter": {
+			params:      map[string]string{"objectLocking": "true"},
+			expectedMsg: `unknown parameter "objectLocking", valid parameters are: forceDelete (immutable)`,
+		},
+		"ill-typed parameter": {
+			params:      map[string]string{local.ForceDeleteKey: "maybe"},
+			expectedMsg: `invalid value "maybe" for parameter "forceDelete": must be a boolean`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := local.New(t.TempDir())
+			require.NoError(t, err)
+
+			server := &ProvisionerServer{
+				Client: client,
+				Config: config.NewStore(config.Config{Mode: config.ModeS3Local}),
+			}
+
+			_, err = server.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{
+				Name:       "bucket",
+				Parameters: tc.params,
+			})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, status.Convert(err).Message(), tc.expectedMsg)
+
+			// the backend is not touched
+			exists, err := client.BucketExists(context.Background(), "bucket")
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestProvisionerServer_CreateBucketImmutableParameter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, err := local.New(t.TempDir())
+	require.NoError(t, err)
+
+	server := &ProvisionerServer{
+		Client: client,
+		Config: config.NewStore(config.Config{Mode: config.ModeS3Local}),
+	}
+	req := &cosi.DriverCreateBucketRequest{
+		Name:       "bucket",
+		Parameters: map[string]string{local.ForceDeleteKey: "true"},
+	}
+	_, err = server.DriverCreateBucket(ctx, req)
+	require.NoError(t, err)
+
+	req.Parameters = map[string]string{local.ForceDeleteKey: "false"}
+	_, err = server.DriverCreateBucket(ctx, req)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `immutable parameter "forceDelete"`)
+}
+
+func TestProvisionerServer_StaticTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	static := config.Tags{"cluster": "prod", "team": "storage"}
+
+	tests := map[string]struct {
+		client       clients.Client
+		params       map[string]string
+		expectedTags string
+		expectedCode codes.Code
+	}{
+		"static tags only": {
+			client:       fake.New("s3"),
+			expectedTags: "cluster=prod,team=storage",
+		},
+		"bucket class tags take precedence": {
+			client:       fake.New("s3"),
+			params:       map[string]string{"tags": "team=finance, env=dev"},
+			expectedTags: "cluster=prod,env=dev,team=finance",
+		},
+		"invalid bucket class tags": {
+			client:       fake.New("s3"),
+			params:       map[string]string{"tags": "team"},
+			expectedCode: codes.InvalidArgument,
+		},
+		"client without tags": {
+			client: func() clients.Client {
+				c, err := local.New(t.TempDir())
+				require.NoError(t, err)
+				return c
+			}(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := &ProvisionerServer{
+				Client: tc.client,
+				Config: config.NewStore(config.Config{Mode: config.ModeS3Fake, Tags: static}),
+			}
+			req := &cosi.DriverCreateBucketRequest{Name: "bucket", Parameters: tc.params}
+
+			_, err := server.DriverCreateBucket(ctx, req)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			if tc.expectedCode != codes.OK {
+				return
+			}
+
+			_, err = server.DriverCreateBucket(ctx, req)
+			require.NoError(t, err)
+
+			if c, ok := tc.client.(*fake.Client); ok {
+				assert.Equal(t, tc.expectedTags, clients.FormatTags(c.Buckets()["bucket"].Tags))
+			}
+			assert.Equal(t, tc.params, req.GetParameters(), "the request is left unchanged")
+		})
+	}
+}
+
+func TestProvisionerServer_ReloadedStaticTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := fake.New("s3")
+	store := config.NewStore(config.Config{Tags: config.Tags{"cluster": "prod"}})
+	server := &ProvisionerServer{Client: client, Config: store}
+	req := &cosi.DriverCreateBucketRequest{
+		Name:       "bucket",
+		Parameters: map[string]string{"tags": "team=storage"},
+	}
+
+	_, err := server.DriverCreateBucket(ctx, req)
+	require.NoError(t, err)
+
+	// retrying the creation of an existing bucket succeeds, as only the tags of the BucketClass are compared
+	store.Set(config.Config{Tags: config.Tags{"cluster": "staging", "owner": "platform"}})
+	_, err = server.DriverCreateBucket(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cluster": "prod", "team": "storage"}, client.Buckets()["bucket"].Tags,
+		"static tags are only applied to new buckets")
+
+	// the tags of the BucketClass are still compared
+	req.Parameters = map[string]string{"tags": "team=finance"}
+	_, err = server.DriverCreateBucket(ctx, req)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+// failingClient is a client whose calls fail with the given error.
+type failingClient struct {
+	clients.Client
+	err error
+}
+
+func (c *failingClient) BucketExists(context.Context, string) (bool, error) {
+	return true, c.err
+}
+
+func (c *failingClient) DeleteBucket(context.Context, string) error {
+	return c.err
+}
+
+func (c *failingClient) CreateBucketAccess(context.Context, string, string) (clients.User, error) {
+	return nil, c.err
+}
+
+func (c *failingClient) DeleteBucketAccess(context.Context, string, string) error {
+	return c.err
+}
+
+func TestProvisionerServer_ClientErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err            error
+		expectedDelete codes.Code
+		expectedGrant  codes.Code
+		expectedRevoke codes.Code
+	}{
+		"bucket not found": {
+			err:            clients.ErrBucketNotFound,
+			expectedDelete: codes.OK,
+			expectedGrant:  codes.NotFound,
+			expectedRevoke: codes.OK,
+		},
+		"bucket not empty": {
+			err:            clients.ErrBucketNotEmpty,
+			expectedDelete: codes.FailedPrecondition,
+			expectedGrant:  codes.FailedPrecondition,
+			expectedRevoke: codes.FailedPrecondition,
+		},
+		"permission denied": {
+			err:            clients.ErrPermissionDenied,
+			expectedDelete: codes.PermissionDenied,
+			expectedGrant:  codes.PermissionDenied,
+			expectedRevoke: codes.PermissionDenied,
+		},
+		"access limit reached": {
+			err:            clients.ErrAccessLimitReached,
+			expectedDelete: codes.ResourceExhausted,
+			expectedGrant:  codes.ResourceExhausted,
+			expectedRevoke: codes.ResourceExhausted,
+		},
+		"not supported": {
+			err:            clients.ErrNotSupported,
+			expectedDelete: codes.Unimplemented,
+			expectedGrant:  codes.Unimplemented,
+			expectedRevoke: codes.Unimplemented,
+		},
+		"throttled": {
+			err:            fmt.Errorf("%w: slow down", clients.ErrThrottled),
+			expectedDelete: codes.Unavailable,
+			expectedGrant:  codes.Unavailable,
+			expectedRevoke: codes.Unavailable,
+		},
+		"unknown error": {
+			err:            errors.New("connection refused"),
+			expectedDelete: codes.Internal,
+			expectedGrant:  codes.Internal,
+			expectedRevoke: codes.Internal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			server := &ProvisionerServer{
+				Client: &failingClient{err: tc.err},
+				Config: config.NewStore(config.Config{}),
+			}
+
+			_, err := server.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "bucket"})
+			assert.Equal(t, tc.expectedDelete, status.Code(err), "delete")
+
+			_, err = server.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+				BucketId: "bucket",
+				Name:     "account",
+			})
+			assert.Equal(t, tc.expectedGrant, status.Code(err), "grant")
+
+			_, err = server.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+				BucketId:  "bucket",
+				AccountId: "account",
+			})
+			assert.Equal(t, tc.expectedRevoke, status.Code(err), "revoke")
+		})
+	}
+}